@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/google/cel-go/ext"
+	"github.com/google/cel-go/interpreter"
+	"github.com/google/cel-go/parser"
+)
+
+// assertVariables contains the names of the variables available to the assertion expressions
+var assertVariables = []string{"request", "response", "steps", "vars"}
+
+// assertEnv is the CEL environment used to evaluate the assertion expressions
+var assertEnv *cel.Env
+
+// assertEnvErr is the error returned by the creation of the CEL environment
+var assertEnvErr error
+
+// assertEnvOnce creates the CEL environment only once, since it is shared by the concurrent validations and test runs
+var assertEnvOnce sync.Once
+
+// getAssertEnv returns the CEL environment used to evaluate the assertion expressions
+func getAssertEnv() (*cel.Env, error) {
+	assertEnvOnce.Do(func() {
+		assertEnv, assertEnvErr = newAssertEnv()
+	})
+	return assertEnv, assertEnvErr
+}
+
+// newAssertEnv creates the CEL environment with the assertion variables and the custom functions
+func newAssertEnv() (*cel.Env, error) {
+	opts := []cel.EnvOption{
+		ext.Strings(),
+		ext.Lists(),
+		ext.Math(),
+		// keep the macro calls to report the values of the sub-expressions
+		cel.EnableMacroCallTracking(),
+		cel.Function("sum",
+			cel.Overload("sum_list", []*cel.Type{cel.ListType(cel.DynType)}, cel.DoubleType,
+				cel.UnaryBinding(celSum),
+			),
+		),
+	}
+	for _, name := range assertVariables {
+		opts = append(opts, cel.Variable(name, cel.DynType))
+	}
+	return cel.NewEnv(opts...)
+}
+
+// celSum returns the sum of a list of numbers
+func celSum(arg ref.Val) ref.Val {
+	list, ok := arg.(traits.Lister)
+	if !ok {
+		return types.MaybeNoSuchOverloadErr(arg)
+	}
+	sum := 0.0
+	it := list.Iterator()
+	for it.HasNext() == types.True {
+		num, err := it.Next().ConvertToNative(reflect.TypeOf(sum))
+		if err != nil {
+			return types.WrapErr(err)
+		}
+		sum += num.(float64)
+	}
+	return types.Double(sum)
+}
+
+// getAssertData returns the variables available to the assertion expressions of the specified step
+func getAssertData(item int) map[string]interface{} {
+	steps := make([]interface{}, 0, item+1)
+	for i := 0; i <= item && i < len(testCache); i++ {
+		steps = append(steps, map[string]interface{}{
+			"Name":     testCache[i].Name,
+			"Topic":    testCache[i].Topic,
+			"Request":  testCache[i].Request,
+			"Response": testCache[i].Response,
+		})
+	}
+	data := map[string]interface{}{
+		"request":  nil,
+		"response": nil,
+		"steps":    steps,
+		"vars":     testVars,
+	}
+	if item < len(testCache) {
+		data["request"] = testCache[item].Request
+		data["response"] = testCache[item].Response
+	}
+	return data
+}
+
+// checkAssertions evaluates the boolean assertion expressions of the specified step
+func checkAssertions(assertions []string, item int) error {
+	if len(assertions) == 0 {
+		return nil
+	}
+	env, err := getAssertEnv()
+	if err != nil {
+		return fmt.Errorf("unable to initialize the assertion environment: %v", err)
+	}
+	data := getAssertData(item)
+	for _, expr := range assertions {
+		err = evalAssertion(env, expr, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evalAssertion evaluates a single assertion expression
+func evalAssertion(env *cel.Env, expr string, data map[string]interface{}) error {
+	checked, iss := env.Compile(expr)
+	if iss != nil && iss.Err() != nil {
+		return fmt.Errorf("invalid assertion %q: %v", expr, iss.Err())
+	}
+	prg, err := env.Program(checked, cel.EvalOptions(cel.OptTrackState))
+	if err != nil {
+		return fmt.Errorf("invalid assertion %q: %v", expr, err)
+	}
+	out, details, err := prg.Eval(data)
+	if err != nil {
+		return getFormattedAssertError(fmt.Sprintf("unable to evaluate the assertion: %v", err), expr, checked, details)
+	}
+	result, ok := out.Value().(bool)
+	if !ok {
+		return getFormattedAssertError("the assertion does not return a boolean value", expr, checked, details)
+	}
+	if !result {
+		return getFormattedAssertError("the assertion is false", expr, checked, details)
+	}
+	return nil
+}
+
+// getFormattedAssertError returns a json string containing the failed expression and the values it evaluated
+func getFormattedAssertError(message string, expr string, checked *cel.Ast, details *cel.EvalDetails) error {
+	type AssertError struct {
+		Error      string                 `json:"error"`      // error message
+		Expression string                 `json:"expression"` // assertion expression
+		Values     map[string]interface{} `json:"values"`     // values of the evaluated sub-expressions
+	}
+	errStruct := &AssertError{
+		Error:      message,
+		Expression: expr,
+	}
+	if details != nil {
+		errStruct.Values = getEvaluatedValues(checked, details.State())
+	}
+	errmsg, err := json.Marshal(errStruct)
+	if err != nil {
+		return fmt.Errorf("%s: %s", message, expr)
+	}
+	return fmt.Errorf("%s", string(errmsg))
+}
+
+// getEvaluatedValues returns the values of the variables, fields and functions evaluated in the expression
+func getEvaluatedValues(checked *cel.Ast, state interpreter.EvalState) map[string]interface{} {
+	values := make(map[string]interface{})
+	native := checked.NativeRep()
+	ast.PreOrderVisit(native.Expr(), ast.NewExprVisitor(func(e ast.Expr) {
+		if !isReportedExpr(e) {
+			return
+		}
+		val, found := state.Value(e.ID())
+		if !found {
+			return
+		}
+		text, err := parser.Unparse(e, native.SourceInfo())
+		if err != nil {
+			return
+		}
+		values[text] = getCelNativeValue(val)
+	}))
+	return values
+}
+
+// isReportedExpr returns true if the value of the expression should be reported
+func isReportedExpr(e ast.Expr) bool {
+	switch e.Kind() {
+	case ast.ComprehensionKind:
+		return true
+	case ast.CallKind:
+		fn := e.AsCall().FunctionName()
+		return !strings.HasPrefix(fn, "_") && !strings.HasPrefix(fn, "@")
+	case ast.SelectKind, ast.IdentKind:
+		for e.Kind() == ast.SelectKind {
+			e = e.AsSelect().Operand()
+		}
+		if e.Kind() != ast.IdentKind {
+			return false
+		}
+		for _, name := range assertVariables {
+			if e.AsIdent() == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getCelNativeValue converts a CEL value into a JSON-encodable value
+func getCelNativeValue(val ref.Val) interface{} {
+	switch v := val.(type) {
+	case traits.Mapper:
+		out := make(map[string]interface{})
+		it := v.Iterator()
+		for it.HasNext() == types.True {
+			key := it.Next()
+			out[fmt.Sprintf("%v", key.Value())] = getCelNativeValue(v.Get(key))
+		}
+		return out
+	case traits.Lister:
+		var out []interface{}
+		it := v.Iterator()
+		for it.HasNext() == types.True {
+			out = append(out, getCelNativeValue(it.Next()))
+		}
+		return out
+	case *types.Err:
+		return v.Error()
+	}
+	return val.Value()
+}
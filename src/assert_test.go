@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+)
+
+func getAssertTestCache() TestEntries {
+	var req0, resp0, resp1 interface{}
+	_ = json.Unmarshal([]byte(`{"user":"alice"}`), &req0)
+	_ = json.Unmarshal([]byte(`{"id":"A1","createdAt":"2017-01-02T15:04:05Z"}`), &resp0)
+	_ = json.Unmarshal([]byte(`{"id":"A2","total":30.5,"items":[{"price":10},{"price":20.5}],"createdAt":"2017-01-02T15:04:05Z","expiresAt":"2017-01-02T16:04:05Z"}`), &resp1)
+	return TestEntries{
+		{Topic: "user.create", Request: req0, Response: resp0},
+		{Topic: "order.create", Request: map[string]interface{}{"user": "A1"}, Response: resp1},
+	}
+}
+
+func TestCheckAssertions(t *testing.T) {
+	testCache = getAssertTestCache()
+	defer func() { testCache = nil }()
+
+	err := checkAssertions([]string{
+		"response.total == sum(response.items.map(i, i.price))",
+		"timestamp(response.expiresAt) > timestamp(response.createdAt)",
+		"request.user == steps[0].Response.id",
+		"response.id != steps[0].Response.id",
+		"size(steps) == 2",
+	}, 1)
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+
+	err = checkAssertions(nil, 1)
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+}
+
+func TestCheckAssertionsErrors(t *testing.T) {
+	testCache = getAssertTestCache()
+	defer func() { testCache = nil }()
+
+	err := checkAssertions([]string{"response.total == sum(response.items.map(i, i.price)) + 1.0"}, 1)
+	if err == nil {
+		t.Error(fmt.Errorf("an error was expected"))
+		return
+	}
+	var errStruct struct {
+		Error  string                 `json:"error"`
+		Values map[string]interface{} `json:"values"`
+	}
+	if jerr := json.Unmarshal([]byte(err.Error()), &errStruct); jerr != nil {
+		t.Error(fmt.Errorf("the error should be JSON encoded: %v", jerr))
+		return
+	}
+	if errStruct.Values["response.total"] != 30.5 {
+		t.Error(fmt.Errorf("the value of response.total should be reported: %v", err))
+	}
+	if errStruct.Values["sum(response.items.map(i, i.price))"] != 30.5 {
+		t.Error(fmt.Errorf("the value of the sum should be reported: %v", err))
+	}
+
+	var testCases = []struct {
+		expr string
+		msg  string
+	}{
+		{"response.total +", "invalid assertion"},
+		{"response.id", "does not return a boolean"},
+		{"response.missing == 1", "unable to evaluate"},
+		{"sum(response.items) > 0.0", "unable to evaluate"},
+	}
+	for _, tt := range testCases {
+		err = checkAssertions([]string{tt.expr}, 1)
+		if err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Error(fmt.Errorf("an error containing %q was expected for %q: %v", tt.msg, tt.expr, err))
+		}
+	}
+}
+
+func TestGetAssertEnvConcurrent(t *testing.T) {
+	envs := make(chan *cel.Env, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			env, err := getAssertEnv()
+			if err != nil {
+				t.Error(fmt.Errorf("an error was not expected: %v", err))
+			}
+			envs <- env
+		}()
+	}
+	wg.Wait()
+	close(envs)
+	first := <-envs
+	for env := range envs {
+		if env != first {
+			t.Error(fmt.Errorf("the assertion environment was expected to be shared"))
+		}
+	}
+}
@@ -47,12 +47,12 @@ func closeNatsBus() {
 }
 
 // send a message to the specified topic and get the raw answer
-func sendBusRequest(topic string, request []byte) ([]byte, error) {
+func sendBusRequest(topic string, request []byte, timeout time.Duration) ([]byte, error) {
 	if topic[0] == '@' {
 		// echo the request for internal testing
 		return request, nil
 	}
-	msg, err := natsConn.Request(topic, request, busTimeout)
+	msg, err := natsConn.Request(topic, request, timeout)
 	if err != nil {
 		if err == nats.ErrTimeout {
 			err = fmt.Errorf("request timeout: %v", err)
@@ -61,3 +61,13 @@ func sendBusRequest(topic string, request []byte) ([]byte, error) {
 	}
 	return msg.Data, nil
 }
+
+// subscribe to the specified subject and return the channel of the received messages and the function to unsubscribe
+func subscribeBus(subject string) (chan *nats.Msg, func(), error) {
+	ch := make(chan *nats.Msg, BusSubscriptionSize)
+	sub, err := natsConn.ChanSubscribe(subject, ch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to subscribe to %s: %v", subject, err)
+	}
+	return ch, func() { _ = sub.Unsubscribe() }, nil
+}
@@ -21,7 +21,7 @@ func TestSendBusRequestError(t *testing.T) {
 		t.Error(fmt.Errorf("Error connecting to the NATS bus"))
 	}
 	defer closeNatsBus()
-	_, err = sendBusRequest("topic", []byte("ABC"))
+	_, err = sendBusRequest("topic", []byte("ABC"), busTimeout)
 	if err == nil {
 		t.Error(fmt.Errorf("an error was expected"))
 	}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -14,42 +18,17 @@ func cli() (*cobra.Command, error) {
 	var natsAddress string
 
 	rootCmd := new(cobra.Command)
-	rootCmd.Flags().StringVarP(&configDir, "configDir", "c", "", "Configuration directory to be added on top of the search list")
-	rootCmd.Flags().StringVarP(&logLevel, "logLevel", "o", "*", "Log level: EMERGENCY, ALERT, CRITICAL, ERROR, WARNING, NOTICE, INFO, DEBUG")
-	rootCmd.Flags().StringVarP(&serverAddress, "serverAddress", "s", "*", "HTTP API URL (ip:port) or just (:port)")
-	rootCmd.Flags().StringVarP(&natsAddress, "natsAddress", "n", "*", "NATS bus Address (nats://ip:port)")
-	err := rootCmd.ParseFlags(os.Args)
-	if err != nil {
-		return nil, err
-	}
+	rootCmd.PersistentFlags().StringVarP(&configDir, "configDir", "c", "", "Configuration directory to be added on top of the search list")
+	rootCmd.PersistentFlags().StringVarP(&logLevel, "logLevel", "o", "*", "Log level: EMERGENCY, ALERT, CRITICAL, ERROR, WARNING, NOTICE, INFO, DEBUG")
+	rootCmd.PersistentFlags().StringVarP(&serverAddress, "serverAddress", "s", "*", "HTTP API URL (ip:port) or just (:port)")
+	rootCmd.PersistentFlags().StringVarP(&natsAddress, "natsAddress", "n", "*", "NATS bus Address (nats://ip:port)")
 
 	rootCmd.Use = "natstest"
 	rootCmd.Short = "NATS Test Component"
 	rootCmd.Long = `NATS Test Component`
 	rootCmd.RunE = func(cmd *cobra.Command, args []string) error {
 
-		// configuration parameters
-		cfgParams, err := getConfigParams()
-		if err != nil {
-			return err
-		}
-		appParams = &cfgParams
-		if logLevel != "*" {
-			appParams.log.Level = logLevel
-		}
-		if serverAddress != "*" {
-			appParams.serverAddress = serverAddress
-		}
-		if natsAddress != "*" {
-			appParams.natsAddress = natsAddress
-		}
-
-		for _, cmd := range cfgParams.validTransfCmd {
-			isValidTransfCmd[cmd] = true
-		}
-
-		// check values
-		err = checkParams(appParams)
+		err := initApp(logLevel, serverAddress, natsAddress)
 		if err != nil {
 			return err
 		}
@@ -60,15 +39,6 @@ func cli() (*cobra.Command, error) {
 			defer stats.Close()
 		}
 
-		// load the test map from the test configuration files
-		err = loadTestMap()
-		if err != nil {
-			return err
-		}
-
-		// initialize the NATS bus
-		initNatsBus(appParams.natsAddress)
-
 		// start the HTTP server
 		return startServer(appParams.serverAddress)
 	}
@@ -84,5 +54,227 @@ func cli() (*cobra.Command, error) {
 	}
 	rootCmd.AddCommand(versionCmd)
 
+	// sub-command to execute the tests without starting the HTTP server
+	var testParamList []string
+	var includeTags string
+	var excludeTags string
+	var runCmd = &cobra.Command{
+		Use:   "run [test names]",
+		Short: "execute the specified tests (default: all) and exit",
+		Long:  `execute the specified tests (default: all) and exit`,
+		// the failures are reported by the command output and logged by main, without the usage text
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			params, err := getCliTestParams(testParamList)
+			if err != nil {
+				return err
+			}
+			filter, err := newTestFilter(includeTags, excludeTags)
+			if err != nil {
+				return err
+			}
+			err = initApp(logLevel, serverAddress, natsAddress)
+			if err != nil {
+				return err
+			}
+			err = initStats(appParams.stats)
+			if err == nil {
+				defer stats.Close()
+			}
+			if len(args) == 0 {
+				args = []string{"all"}
+			}
+			// cancel the test run on SIGINT, so the teardown entries are still executed
+			stop := make(chan os.Signal, 1)
+			signal.Notify(stop, os.Interrupt)
+			defer close(stop)
+			defer signal.Stop(stop)
+			go cancelOnInterrupt(stop)
+			return runCliTests(args, params, filter)
+		},
+	}
+	runCmd.Flags().StringArrayVarP(&testParamList, "param", "p", []string{}, "Test parameter in the form key=value (can be repeated)")
+	runCmd.Flags().StringVarP(&includeTags, "include", "i", "", "Tag expression of the tests to execute (e.g. \"smoke && !slow\")")
+	runCmd.Flags().StringVarP(&excludeTags, "exclude", "x", "", "Tag expression of the tests to skip")
+	rootCmd.AddCommand(runCmd)
+
+	// sub-command to validate the test files without executing them
+	var validateCmd = &cobra.Command{
+		Use:   "validate [test names]",
+		Short: "validate the specified test files (default: all) and the fragment files without executing them",
+		Long:  `validate the specified test files (default: all) and the fragment files without executing them`,
+		// the failures are reported by the command output and logged by main, without the usage text
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := initConfig(logLevel, serverAddress, natsAddress)
+			if err != nil {
+				return err
+			}
+			if len(args) == 0 {
+				args = []string{"all"}
+			}
+			return validateCliTests(args)
+		},
+	}
+	rootCmd.AddCommand(validateCmd)
+
+	cmd, flags, err := rootCmd.Find(os.Args[1:])
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.ParseFlags(flags)
+	if err != nil {
+		return nil, err
+	}
+
 	return rootCmd, nil
 }
+
+// initApp loads the configuration and the test map, and initializes the NATS bus
+func initApp(logLevel, serverAddress, natsAddress string) error {
+	err := initConfig(logLevel, serverAddress, natsAddress)
+	if err != nil {
+		return err
+	}
+
+	// load the test map from the test configuration files
+	err = loadTestMap()
+	if err != nil {
+		return err
+	}
+
+	// initialize the NATS bus
+	initNatsBus(appParams.natsAddress)
+
+	return nil
+}
+
+// initConfig loads the configuration, the valid commands, the JWT keys and the WebAssembly plugins
+func initConfig(logLevel, serverAddress, natsAddress string) error {
+
+	// configuration parameters
+	cfgParams, err := getConfigParams()
+	if err != nil {
+		return err
+	}
+	appParams = &cfgParams
+	if logLevel != "*" {
+		appParams.log.Level = logLevel
+	}
+	if serverAddress != "*" {
+		appParams.serverAddress = serverAddress
+	}
+	if natsAddress != "*" {
+		appParams.natsAddress = natsAddress
+	}
+
+	setValidTransfCmds(cfgParams.validTransfCmd)
+	jwtKeys = make(map[string]JWTKey)
+	for name, key := range cfgParams.jwtKeys {
+		jwtKeys[strings.ToLower(name)] = key
+	}
+
+	// check values
+	err = checkParams(appParams)
+	if err != nil {
+		return err
+	}
+
+	// load the WebAssembly plugins
+	return loadWasmPlugins(cfgParams.wasmPlugins)
+}
+
+// getCliTestParams parses the list of key=value test parameters
+func getCliTestParams(list []string) (map[string]string, error) {
+	params := make(map[string]string)
+	for _, item := range list {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid test parameter (expected key=value): %s", item)
+		}
+		params[kv[0]] = kv[1]
+	}
+	return params, nil
+}
+
+// runCliTests executes the specified tests and prints a JSON summary on the standard output
+func runCliTests(names []string, params map[string]string, filter *testFilter) (err error) {
+	startTime = time.Now()
+	results := []TestResult{}
+	for _, name := range names {
+		var res []TestResult
+		res, err = runTests(name, params, filter)
+		results = append(results, res...)
+		if err != nil {
+			break
+		}
+	}
+	type info struct {
+		Tests    int          `json:"tests"`           // number of executed tests (or data rows)
+		Duration float64      `json:"duration"`        // full test duration in seconds
+		Message  string       `json:"message"`         // message
+		Error    string       `json:"error,omitempty"` // error message
+		Results  []TestResult `json:"results"`         // result of each test (or data row)
+	}
+	summary := info{
+		Tests:    len(results),
+		Duration: time.Since(startTime).Seconds(),
+		Message:  "All tests completed successfully",
+		Results:  results,
+	}
+	if err != nil {
+		summary.Message = "Test failed"
+		summary.Error = err.Error()
+	}
+	out, jerr := json.MarshalIndent(summary, "", "  ")
+	if jerr == nil {
+		fmt.Println(string(out))
+	}
+	return err
+}
+
+// validateCliTests validates the specified test files and prints a JSON report on the standard output
+func validateCliTests(names []string) error {
+	reports, err := validateTestFiles(names)
+	if err != nil {
+		return err
+	}
+	type info struct {
+		Files    int                `json:"files"`    // number of validated files
+		Problems int                `json:"problems"` // total number of problems
+		Reports  []ValidationReport `json:"reports"`  // problems of each file
+	}
+	summary := info{
+		Files:    len(reports),
+		Problems: countProblems(reports),
+		Reports:  reports,
+	}
+	out, jerr := json.MarshalIndent(summary, "", "  ")
+	if jerr == nil {
+		fmt.Println(string(out))
+	}
+	if summary.Problems > 0 {
+		return fmt.Errorf("found %d problems in the test files", summary.Problems)
+	}
+	return nil
+}
+
+// cancelOnInterrupt cancels the test run on every interrupt signal: the first one stops the test steps and the second one
+// also stops the waits of the teardown entries; when no test is running, or on a further interrupt,
+// the signal is restored to its default behavior and raised again to terminate the command
+func cancelOnInterrupt(stop chan os.Signal) {
+	count := 0
+	for sig := range stop {
+		count++
+		if cancelTestRun() && count <= 2 {
+			continue
+		}
+		signal.Stop(stop)
+		if p, err := os.FindProcess(os.Getpid()); err == nil {
+			_ = p.Signal(sig)
+		}
+		return
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"reflect"
 	"sync"
 	"syscall"
@@ -192,10 +193,20 @@ func startTestClient(t *testing.T) {
 	testEndPoint(t, "GET", "/test/MISSING", "", 404)
 	// test internal test config
 	testEndPoint(t, "GET", "/test/@cli", "", 200)
+	testEndPoint(t, "GET", "/test/@internal", "", 200)
 	testEndPoint(t, "GET", "/test/one", "", 200)
+	testEndPoint(t, "GET", "/test/one?unused=param", "", 200)
+	testEndPoint(t, "GET", "/test/yaml", "", 200)
+	testEndPoint(t, "GET", "/test/fragment", "", 200)
+	testEndPoint(t, "GET", "/test/data", "", 200)
+	testEndPoint(t, "GET", "/test/all?include=yaml%26%26smoke&exclude=slow", "", 200)
+	testEndPoint(t, "GET", "/test/all?include=%28yaml", "", 400)
 	// test all, including a faulty json config test
 	testEndPoint(t, "GET", "/test/all", "", 200)
 
+	// no test to cancel
+	testEndPoint(t, "POST", "/cancel", "", 404)
+
 	// test busy mode
 	setBusy(true)
 	defer setBusy(false)
@@ -263,6 +274,22 @@ func startTestClient(t *testing.T) {
 	// check the reload status
 	testEndPoint(t, "GET", "/test/@alpha", "", 404)
 
+	// test YAML entry
+	yamlraw := `
+- Topic: "@.put.yaml.test"
+  Request: {value: 123}  # comment
+  Response: {value: "~re:[0-9]+"}
+`
+	testEndPoint(t, "PUT", "/new/@gamma", yamlraw, 200)
+	testEndPoint(t, "PUT", "/new/@gamma", "- Topic: [", 417)
+	testEndPoint(t, "DELETE", "/delete/@gamma", "", 200)
+
+	// test validation without loading
+	testEndPoint(t, "POST", "/validate/@delta", jsonraw, 200)
+	testEndPoint(t, "POST", "/validate/@delta", yamlraw, 200)
+	testEndPoint(t, "POST", "/validate/@delta", `[{"Topic": "@.validate", "Request": "~pv:1.Request"}]`, 417)
+	testEndPoint(t, "GET", "/test/@delta", "", 404)
+
 	// test add/delete
 	testEndPoint(t, "PUT", "/new/@beta", jsonraw, 200)
 	testEndPoint(t, "DELETE", "/delete/@beta", "", 200)
@@ -331,6 +358,89 @@ func startTestClient(t *testing.T) {
 	testEndPoint(t, "GET", "/reload", "", 500)
 }
 
+func TestCliRun(t *testing.T) {
+	os.Args = []string{ProgramName, "run", "@cli", "--param", "key=value", "--natsAddress=nats://127.0.0.1:4222"}
+	cmd, err := cli()
+	if err != nil {
+		t.Error(fmt.Errorf("Unexpected error: %v", err))
+		return
+	}
+	old := os.Stdout // keep backup of the real stdout
+	defer func() { os.Stdout = old }()
+	os.Stdout = nil
+
+	if err := cmd.Execute(); err != nil {
+		t.Error(fmt.Errorf("An error was not expected: %v", err))
+	}
+
+	os.Args = []string{ProgramName, "run", "MISSING"}
+	cmd, _ = cli()
+	if err := cmd.Execute(); err == nil {
+		t.Error(fmt.Errorf("An error was expected"))
+	}
+
+	os.Args = []string{ProgramName, "run", "--param", "invalid"}
+	cmd, _ = cli()
+	if err := cmd.Execute(); err == nil {
+		t.Error(fmt.Errorf("An error was expected"))
+	}
+
+	os.Args = []string{ProgramName, "run", "--include", "yaml && !slow", "--exclude", "internal", "--natsAddress=nats://127.0.0.1:4222"}
+	cmd, _ = cli()
+	if err := cmd.Execute(); err != nil {
+		t.Error(fmt.Errorf("An error was not expected: %v", err))
+	}
+
+	os.Args = []string{ProgramName, "run", "--exclude", "yaml &&"}
+	cmd, _ = cli()
+	if err := cmd.Execute(); err == nil {
+		t.Error(fmt.Errorf("An error was expected"))
+	}
+}
+
+func TestCliValidate(t *testing.T) {
+	old := os.Stdout // keep backup of the real stdout
+	defer func() { os.Stdout = old }()
+	os.Stdout = nil
+
+	os.Args = []string{ProgramName, "validate", "one", "@cli"}
+	cmd, err := cli()
+	if err != nil {
+		t.Error(fmt.Errorf("Unexpected error: %v", err))
+		return
+	}
+	if err := cmd.Execute(); err != nil {
+		t.Error(fmt.Errorf("An error was not expected: %v", err))
+	}
+
+	os.Args = []string{ProgramName, "validate", "MISSING"}
+	cmd, _ = cli()
+	if err := cmd.Execute(); err == nil {
+		t.Error(fmt.Errorf("An error was expected"))
+	}
+}
+
+func TestCliSilenceUsage(t *testing.T) {
+	old := os.Stdout // keep backup of the real stdout
+	defer func() { os.Stdout = old }()
+	os.Stdout = nil
+
+	// the failures of the run and validate commands don't print the usage text and the error
+	for _, command := range []string{"run", "validate"} {
+		os.Args = []string{ProgramName, command, "MISSING"}
+		cmd, _ := cli()
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetErr(&out)
+		if err := cmd.Execute(); err == nil {
+			t.Error(fmt.Errorf("%s: an error was expected", command))
+		}
+		if out.Len() > 0 {
+			t.Error(fmt.Errorf("%s: no output was expected, found: %s", command, out.String()))
+		}
+	}
+}
+
 // triggerPanic triggers a Panic
 func triggerPanic(rw http.ResponseWriter, hr *http.Request, ps httprouter.Params) {
 	panic("TEST PANIC")
@@ -380,3 +490,38 @@ func testEndPoint(t *testing.T, method string, path string, data string, code in
 		t.Error(fmt.Errorf("The body is not JSON"))
 	}
 }
+
+func TestCancelOnInterrupt(t *testing.T) {
+	// the raised signal is received here instead of terminating the test process
+	raised := make(chan os.Signal, 1)
+	signal.Notify(raised, os.Interrupt)
+	defer signal.Stop(raised)
+
+	stop := make(chan os.Signal, 3)
+	done := make(chan bool)
+	go func() {
+		cancelOnInterrupt(stop)
+		close(done)
+	}()
+
+	startTestRun()
+	stop <- os.Interrupt
+	time.Sleep(20 * time.Millisecond)
+	if checkTestRun() == nil {
+		t.Error(fmt.Errorf("the test run was expected to be cancelled"))
+	}
+	endTestRun()
+
+	// no test is running: the signal is raised again
+	stop <- os.Interrupt
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error(fmt.Errorf("the interrupt loop was expected to end"))
+	}
+	select {
+	case <-raised:
+	case <-time.After(time.Second):
+		t.Error(fmt.Errorf("the interrupt signal was expected to be raised again"))
+	}
+}
@@ -3,15 +3,46 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"os/exec"
 	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
+// strictKey is the map key used in the expected template to enable the strict mode on a single object
+const strictKey = "~strict"
+
+// strictItem is the first item of an expected array used to enable the strict mode on a single array
+const strictItem = "~strict"
+
+// unorderedItem is the first item of an expected array used to match the items in any order
+const unorderedItem = "~unordered"
+
+// containsItem is the first item of an expected array used to check that each expected item matches a distinct actual item
+const containsItem = "~contains"
+
+// absentValue is the expected value used to check that a field is not defined
+const absentValue = "~absent"
+
+// presentValue is the expected value used to check that a field is defined (with any value, including null)
+const presentValue = "~present"
+
+// nullValue is the expected value used to check that a field is defined and null
+const nullValue = "~null"
+
+// notPrefix is the prefix of the expected values that must not match (e.g. "~not:~re:[0-9]+")
+const notPrefix = "~not:"
+
 // check if the messages are matching
 func areMatching(expected interface{}, actual interface{}) (err error) {
-	err = checkMatch(reflect.ValueOf(expected), reflect.ValueOf(actual))
+	return matchMessages(expected, actual, false)
+}
+
+// matchMessages check if the messages are matching;
+// in strict mode the actual message can't contain fields or items that are not in the expected one
+func matchMessages(expected interface{}, actual interface{}, strict bool) (err error) {
+	err = checkMatch(reflect.ValueOf(expected), reflect.ValueOf(actual), strict)
 	if err != nil {
 		return getFormattedDiffError(err.Error(), expected, actual)
 	}
@@ -20,7 +51,12 @@ func areMatching(expected interface{}, actual interface{}) (err error) {
 
 // checkMatch is a recursive function to check if the fields defined
 // in "expected" are defined and have the same value in "actual"
-func checkMatch(expected reflect.Value, actual reflect.Value) (err error) {
+func checkMatch(expected reflect.Value, actual reflect.Value, strict bool) (err error) {
+
+	// these matchers can also check missing and null values
+	if value := getStringValue(expected); isPresenceMatcher(value) {
+		return processCompareMatcher(value, actual, strict)
+	}
 
 	if (expected.Kind() != actual.Kind()) && (expected.Kind() != reflect.String) {
 		return getFormattedDiffError("the types are different", expected, actual)
@@ -35,16 +71,16 @@ func checkMatch(expected reflect.Value, actual reflect.Value) (err error) {
 		fallthrough
 
 	case reflect.Interface:
-		return checkMatch(expected.Elem(), actual.Elem())
+		return checkMatch(expected.Elem(), actual.Elem(), strict)
 
 	case reflect.Struct:
-		return processCompareStruct(expected, actual)
+		return processCompareStruct(expected, actual, strict)
 
 	case reflect.Slice:
-		return processCompareSlice(expected, actual)
+		return processCompareSlice(expected, actual, strict)
 
 	case reflect.Map:
-		return processCompareMap(expected, actual)
+		return processCompareMap(expected, actual, strict)
 
 	default:
 		return processCompareDefault(expected, actual)
@@ -52,13 +88,85 @@ func checkMatch(expected reflect.Value, actual reflect.Value) (err error) {
 	}
 }
 
+// processCompareMatcher process the absence, presence, null and negation matchers
+func processCompareMatcher(value string, actual reflect.Value, strict bool) (err error) {
+	switch value {
+	case absentValue:
+		if actual.IsValid() {
+			return getFormattedDiffError("the value should be absent", value, actual.Interface())
+		}
+		return nil
+	case presentValue:
+		if !actual.IsValid() {
+			return getFormattedDiffError("the value is missing", value, nil)
+		}
+		return nil
+	case nullValue:
+		if !isNullValue(actual) {
+			return getFormattedDiffError("the value should be null", value, getValidInterface(actual))
+		}
+		return nil
+	}
+	// negation
+	expected := getNegatedValue(value[len(notPrefix):])
+	if expected == nil {
+		expected = nullValue
+	}
+	if !actual.IsValid() && !isPresenceMatcher(expected) {
+		// a missing value does not match any value or value matcher
+		return nil
+	}
+	if actual.Kind() == reflect.Interface && !actual.IsNil() {
+		actual = actual.Elem()
+	}
+	if checkMatch(reflect.ValueOf(expected), actual, strict) == nil {
+		return getFormattedDiffError("the value should not match", value, getValidInterface(actual))
+	}
+	return nil
+}
+
+// getNegatedValue returns the expected value to be negated:
+// a template value, a matcher, a JSON-encoded value or a simple string.
+func getNegatedValue(value string) interface{} {
+	if newval, ok := getTemplateValue(value); ok {
+		return newval
+	}
+	if strings.HasPrefix(value, "~") {
+		// matcher
+		return value
+	}
+	var newval interface{}
+	if json.Unmarshal([]byte(value), &newval) != nil {
+		return value
+	}
+	return newval
+}
+
+// isPresenceMatcher returns true if the value is one of the matchers that can also check missing values
+func isPresenceMatcher(value interface{}) bool {
+	s, ok := value.(string)
+	return ok && (s == absentValue || s == presentValue || s == nullValue || strings.HasPrefix(s, notPrefix))
+}
+
+// isNullValue returns true if the value is defined and null
+func isNullValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+		return value.IsNil()
+	}
+	return false
+}
+
 // processCompareStruct process the Struct case
-func processCompareStruct(expected reflect.Value, actual reflect.Value) (err error) {
+func processCompareStruct(expected reflect.Value, actual reflect.Value, strict bool) (err error) {
 	if expected.NumField() > actual.NumField() {
 		return getFormattedDiffError("missing struct fields", expected, actual)
 	}
+	if strict && expected.NumField() < actual.NumField() {
+		return getFormattedDiffError("unexpected struct fields", expected, actual)
+	}
 	for i := 0; i < expected.NumField(); i++ {
-		err = checkMatch(expected.Field(i), actual.Field(i))
+		err = checkMatch(expected.Field(i), actual.Field(i), strict)
 		if err != nil {
 			return err
 		}
@@ -67,12 +175,27 @@ func processCompareStruct(expected reflect.Value, actual reflect.Value) (err err
 }
 
 // processCompareSlice process the Slice case
-func processCompareSlice(expected reflect.Value, actual reflect.Value) (err error) {
+func processCompareSlice(expected reflect.Value, actual reflect.Value, strict bool) (err error) {
+	if expected.Len() > 0 {
+		// the first item can be a marker for the array matching mode
+		switch getStringValue(expected.Index(0)) {
+		case strictItem:
+			strict = true
+			expected = expected.Slice(1, expected.Len())
+		case unorderedItem:
+			return processCompareUnorderedSlice(expected.Slice(1, expected.Len()), actual, strict, false)
+		case containsItem:
+			return processCompareUnorderedSlice(expected.Slice(1, expected.Len()), actual, strict, true)
+		}
+	}
 	if expected.Len() > actual.Len() {
 		return getFormattedDiffError("missing slice items", expected, actual)
 	}
+	if strict && expected.Len() < actual.Len() {
+		return getFormattedDiffError("unexpected slice items", expected.Interface(), actual.Slice(expected.Len(), actual.Len()).Interface())
+	}
 	for i := 0; i < expected.Len(); i++ {
-		err = checkMatch(expected.Index(i), actual.Index(i))
+		err = checkMatch(expected.Index(i), actual.Index(i), strict)
 		if err != nil {
 			return err
 		}
@@ -80,19 +203,151 @@ func processCompareSlice(expected reflect.Value, actual reflect.Value) (err erro
 	return nil
 }
 
+// processCompareUnorderedSlice process the Slice case when the items can be in any order.
+// Each expected item must match a distinct actual item; if contains is false the arrays must also have the same length.
+func processCompareUnorderedSlice(expected reflect.Value, actual reflect.Value, strict bool, contains bool) (err error) {
+	if expected.Len() > actual.Len() {
+		return getFormattedDiffError("missing slice items", expected.Interface(), actual.Interface())
+	}
+	if !contains && expected.Len() < actual.Len() {
+		return getFormattedDiffError("unexpected slice items", expected.Interface(), actual.Interface())
+	}
+	// find the actual items matching each expected item
+	candidates := make([][]int, expected.Len())
+	for i := 0; i < expected.Len(); i++ {
+		for j := 0; j < actual.Len(); j++ {
+			if checkMatch(expected.Index(i), actual.Index(j), strict) == nil {
+				candidates[i] = append(candidates[i], j)
+			}
+		}
+	}
+	pairs := getSliceMatching(candidates, actual.Len())
+	var missing []string
+	var items []interface{}
+	for i, j := range pairs {
+		if j < 0 {
+			missing = append(missing, strconv.Itoa(i))
+			items = append(items, expected.Index(i).Interface())
+		}
+	}
+	if len(missing) > 0 {
+		return getFormattedDiffError("no matching actual item for the expected slice items: "+strings.Join(missing, ", "), items, actual.Interface())
+	}
+	// compare again the paired items to set the variables captured by the regular expressions
+	for i, j := range pairs {
+		err = checkMatch(expected.Index(i), actual.Index(j), strict)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getSliceMatching returns the index of the actual item paired with each expected item (or -1 if missing),
+// maximizing the number of pairs (bipartite matching using augmenting paths).
+func getSliceMatching(candidates [][]int, size int) []int {
+	owner := make([]int, size) // expected item paired with each actual item
+	for j := range owner {
+		owner[j] = -1
+	}
+	var augment func(i int, seen []bool) bool
+	augment = func(i int, seen []bool) bool {
+		for _, j := range candidates[i] {
+			if seen[j] {
+				continue
+			}
+			seen[j] = true
+			if owner[j] < 0 || augment(owner[j], seen) {
+				owner[j] = i
+				return true
+			}
+		}
+		return false
+	}
+	for i := range candidates {
+		augment(i, make([]bool, size))
+	}
+	pairs := make([]int, len(candidates))
+	for i := range pairs {
+		pairs[i] = -1
+	}
+	for j, i := range owner {
+		if i >= 0 {
+			pairs[i] = j
+		}
+	}
+	return pairs
+}
+
 // processCompareMap process the Map case
-func processCompareMap(expected reflect.Value, actual reflect.Value) (err error) {
+func processCompareMap(expected reflect.Value, actual reflect.Value, strict bool) (err error) {
+	if isStrictMap(expected) {
+		// the strict mode marker applies to this object and all its children
+		strict = true
+	}
 	for _, key := range expected.MapKeys() {
-		err = checkMatch(expected.MapIndex(key), actual.MapIndex(key))
+		if key.Kind() == reflect.String && key.String() == strictKey {
+			continue
+		}
+		err = checkMatch(expected.MapIndex(key), actual.MapIndex(key), strict)
 		if err != nil {
 			return err
 		}
 	}
+	if strict {
+		var keys []string
+		extra := make(map[string]interface{})
+		for _, key := range actual.MapKeys() {
+			if !expected.MapIndex(key).IsValid() {
+				name := fmt.Sprintf("%v", key.Interface())
+				keys = append(keys, name)
+				extra[name] = actual.MapIndex(key).Interface()
+			}
+		}
+		if len(keys) > 0 {
+			sort.Strings(keys)
+			return getFormattedDiffError("unexpected map keys: "+strings.Join(keys, ", "), expected.Interface(), extra)
+		}
+	}
 	return nil
 }
 
+// isStrictMap returns true if the expected map contains the strict mode marker set to true
+func isStrictMap(expected reflect.Value) bool {
+	if expected.Type().Key().Kind() != reflect.String {
+		return false
+	}
+	value := expected.MapIndex(reflect.ValueOf(strictKey).Convert(expected.Type().Key()))
+	if value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+	return value.Kind() == reflect.Bool && value.Bool()
+}
+
+// getStringValue returns the string contained in the value or an empty string
+func getStringValue(value reflect.Value) string {
+	if value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.String {
+		return ""
+	}
+	return value.String()
+}
+
+// init registers the built-in matchers
+func init() {
+	mustRegisterMatcher("re", processCompareRegexp)
+	mustRegisterMatcher("xc", processCompareExternal)
+	mustRegisterMatcher("tm", processCompareTime)
+	mustRegisterMatcher("jv", processCompareJWT)
+}
+
 // processCompareDefault process the Default case
 func processCompareDefault(expected reflect.Value, actual reflect.Value) (err error) {
+	if !actual.IsValid() {
+		return getFormattedDiffError("the value is missing", getValidInterface(expected), nil)
+	}
 	if expected.Interface() == actual.Interface() {
 		return nil
 	}
@@ -101,61 +356,72 @@ func processCompareDefault(expected reflect.Value, actual reflect.Value) (err er
 	}
 	// extract string value
 	value := expected.Interface().(string)
-	if len(value) < 5 || (value[0:4] != "~re:" && value[0:4] != "~xc:") {
-		// the value is not a regular expression
+	matcher, arg, ok := getMatcher(value)
+	if !ok {
+		// the value is not a matcher
 		return getFormattedDiffError("values are different", expected, actual)
 	}
-	if value[0:4] == "~xc:" {
-		// use external comparison tool
-		parts := strings.SplitN(value[4:], ":", 2)
-		return processCompareExternal(parts[0], parts[1], actual)
-	}
-	// compare using a regular expression
-	sv := fmt.Sprintf("%v", actual.Interface())
-	match, err := regexp.MatchString(value[4:], sv)
+	return matcher.Match(arg, getValidInterface(actual))
+}
+
+// processCompareRegexp compare the actual value with a regular expression ("~re:")
+func processCompareRegexp(arg string, actual interface{}) error {
+	sv := fmt.Sprintf("%v", actual)
+	re, err := regexp.Compile(arg)
 	if err != nil {
 		return fmt.Errorf("%v", err)
 	}
-	if !match {
-		return getFormattedDiffError("the regular expression do not match", expected, actual)
+	match := re.FindStringSubmatch(sv)
+	if match == nil {
+		return getFormattedDiffError("the regular expression do not match", "~re:"+arg, actual)
 	}
+	storeRegexpGroups(re, match)
 	return nil
 }
 
-// processCompareExternal compare values using an external tool.
+// storeRegexpGroups stores the values of the named groups of a regular expression as test variables
+func storeRegexpGroups(re *regexp.Regexp, match []string) {
+	if testVars == nil {
+		return
+	}
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			testVars[name] = match[i]
+		}
+	}
+}
+
+// processCompareExternal compare values using an external tool ("~xc:TOOL:EXPECTED").
 // The external tool must accept two arguments, the first is the expected value and the second is the actual value.
 // If the actual value is not a simple string, then it is encoded in JSON.
-func processCompareExternal(tool string, expected string, actual reflect.Value) (err error) {
-	if !isValidTransfCmd[tool] {
-		return fmt.Errorf("the following command is not valid: %v", tool)
-	}
-	var actualstr string
-	if reflect.TypeOf(actual.Interface()).Kind() == reflect.String {
-		actualstr = actual.Interface().(string)
-	} else {
-		// encode the object as JSON string
-		jsonval, err := json.Marshal(actual.Interface())
-		if err != nil {
-			return fmt.Errorf("unable to json-encode the actual value: %#v -- [%v]", actual.Interface(), err)
-		}
-		actualstr = string(jsonval)
+func processCompareExternal(arg string, actual interface{}) (err error) {
+	parts := strings.SplitN(arg, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("the external comparison requires the command and the expected value: %v", arg)
+	}
+	tool, expected := parts[0], parts[1]
+	actualstr, err := getTransfString(actual)
+	if err != nil {
+		return fmt.Errorf("unable to json-encode the actual value: %v", err)
 	}
-	/* #nosec */
-	_, err = exec.Command(tool, expected, actualstr).Output()
+	_, err = execCommand(tool, expected, actualstr)
 	if err != nil {
 		return fmt.Errorf("failed comparing the values using the command: %v -- [%v]", tool, err)
 	}
 	return nil
 }
 
+// compareError contains the details of a comparison error
+type compareError struct {
+	Error    string      `json:"error"`             // error message
+	Pointer  string      `json:"pointer,omitempty"` // JSON pointer of the actual value (if any)
+	Expected interface{} `json:"expected"`          // expected value
+	Actual   interface{} `json:"actual"`            // actual value
+}
+
 // getFormattedDiffError returns a json string containing the expected and actual object
 func getFormattedDiffError(message string, expected interface{}, actual interface{}) error {
-	type CompareError struct {
-		Error    string      `json:"error"`    // error message
-		Expected interface{} `json:"expected"` // expected value
-		Actual   interface{} `json:"actual"`   // actual value
-	}
-	errStruct := &CompareError{
+	errStruct := &compareError{
 		Error:    message,
 		Expected: expected,
 		Actual:   actual,
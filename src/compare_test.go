@@ -1,8 +1,10 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -158,3 +160,263 @@ func TestAreMatchingMap(t *testing.T) {
 		t.Error(fmt.Errorf("an error was expected"))
 	}
 }
+
+func TestAreMatchingStrict(t *testing.T) {
+
+	var expected interface{}
+	var actual interface{}
+	_ = json.Unmarshal([]byte(`{"a":1,"b":[1,2],"c":{"d":"e"}}`), &expected)
+	_ = json.Unmarshal([]byte(`{"a":1,"b":[1,2],"c":{"d":"e"}}`), &actual)
+
+	err := matchMessages(expected, actual, true)
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+
+	// extra map key
+	_ = json.Unmarshal([]byte(`{"a":1,"b":[1,2],"c":{"d":"e","hash":"secret"}}`), &actual)
+	err = matchMessages(expected, actual, false)
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+	err = matchMessages(expected, actual, true)
+	if err == nil || !strings.Contains(err.Error(), "unexpected map keys: hash") {
+		t.Error(fmt.Errorf("an error was expected: %v", err))
+	}
+
+	// extra slice item
+	_ = json.Unmarshal([]byte(`{"a":1,"b":[1,2,3],"c":{"d":"e"}}`), &actual)
+	err = matchMessages(expected, actual, false)
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+	err = matchMessages(expected, actual, true)
+	if err == nil || !strings.Contains(err.Error(), "unexpected slice items") {
+		t.Error(fmt.Errorf("an error was expected: %v", err))
+	}
+
+	// struct
+	type Vertex2 struct {
+		X int
+		Y int
+	}
+	type Vertex3 struct {
+		X int
+		Y int
+		Z int
+	}
+	err = matchMessages(Vertex2{3, 5}, Vertex3{3, 5, 7}, true)
+	if err == nil {
+		t.Error(fmt.Errorf("an error was expected"))
+	}
+}
+
+func TestAreMatchingStrictMarkers(t *testing.T) {
+
+	var expected interface{}
+	var actual interface{}
+
+	// strict object
+	_ = json.Unmarshal([]byte(`{"a":1,"c":{"~strict":true,"d":"e"}}`), &expected)
+	_ = json.Unmarshal([]byte(`{"a":1,"b":2,"c":{"d":"e"}}`), &actual)
+	err := areMatching(expected, actual)
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+	_ = json.Unmarshal([]byte(`{"a":1,"b":2,"c":{"d":"e","f":"g"}}`), &actual)
+	err = areMatching(expected, actual)
+	if err == nil || !strings.Contains(err.Error(), "unexpected map keys: f") {
+		t.Error(fmt.Errorf("an error was expected: %v", err))
+	}
+
+	// strict object propagates to the children
+	_ = json.Unmarshal([]byte(`{"~strict":true,"c":{"d":"e"}}`), &expected)
+	_ = json.Unmarshal([]byte(`{"c":{"d":"e","f":"g"}}`), &actual)
+	err = areMatching(expected, actual)
+	if err == nil {
+		t.Error(fmt.Errorf("an error was expected"))
+	}
+
+	// strict array
+	_ = json.Unmarshal([]byte(`{"a":["~strict",1,2],"b":[1]}`), &expected)
+	_ = json.Unmarshal([]byte(`{"a":[1,2],"b":[1,2]}`), &actual)
+	err = areMatching(expected, actual)
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+	_ = json.Unmarshal([]byte(`{"a":[1,2,3],"b":[1,2]}`), &actual)
+	err = areMatching(expected, actual)
+	if err == nil || !strings.Contains(err.Error(), "unexpected slice items") {
+		t.Error(fmt.Errorf("an error was expected: %v", err))
+	}
+
+	// the marker is ignored for non-string keys
+	err = areMatching(map[int]int{1: 2}, map[int]int{1: 2, 3: 4})
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+}
+
+func TestAreMatchingUnordered(t *testing.T) {
+
+	var testCases = []struct {
+		expected string
+		actual   string
+		match    bool
+	}{
+		{`["~unordered",1,2,3]`, `[3,1,2]`, true},
+		{`["~unordered",1,2,3]`, `[3,1,2,4]`, false},
+		{`["~unordered",1,2,3]`, `[3,1]`, false},
+		{`["~unordered",1,1,2]`, `[1,2,2]`, false},
+		{`["~unordered",{"id":"~re:[0-9]+"},{"id":"1"}]`, `[{"id":"1"},{"id":"2"}]`, true},
+		{`["~unordered",{"a":1},{"a":1,"b":2}]`, `[{"a":1,"b":2},{"a":1,"c":3}]`, true},
+		{`["~contains",2,3]`, `[1,2,3,4]`, true},
+		{`["~contains",3,3]`, `[1,2,3,4]`, false},
+		{`["~contains",5]`, `[1,2,3,4]`, false},
+		{`["~contains",1,2,3]`, `[1,2]`, false},
+		{`["~contains"]`, `[]`, true},
+	}
+	for _, tt := range testCases {
+		var expected interface{}
+		var actual interface{}
+		_ = json.Unmarshal([]byte(tt.expected), &expected)
+		_ = json.Unmarshal([]byte(tt.actual), &actual)
+		err := areMatching(expected, actual)
+		if tt.match && err != nil {
+			t.Error(fmt.Errorf("an error was not expected (%s, %s): %v", tt.expected, tt.actual, err))
+		}
+		if !tt.match && err == nil {
+			t.Error(fmt.Errorf("an error was expected (%s, %s)", tt.expected, tt.actual))
+		}
+	}
+}
+
+func TestAreMatchingUnorderedStrict(t *testing.T) {
+	var expected interface{}
+	var actual interface{}
+	_ = json.Unmarshal([]byte(`["~contains",{"a":1}]`), &expected)
+	_ = json.Unmarshal([]byte(`[{"a":1,"b":2}]`), &actual)
+	err := matchMessages(expected, actual, false)
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+	err = matchMessages(expected, actual, true)
+	if err == nil {
+		t.Error(fmt.Errorf("an error was expected"))
+	}
+}
+
+func TestAreMatchingUnorderedReport(t *testing.T) {
+	var expected interface{}
+	var actual interface{}
+	_ = json.Unmarshal([]byte(`["~unordered","a","x","c","y"]`), &expected)
+	_ = json.Unmarshal([]byte(`["c","b","a","d"]`), &actual)
+	err := areMatching(expected, actual)
+	if err == nil || !strings.Contains(err.Error(), "expected slice items: 1, 3") {
+		t.Error(fmt.Errorf("an error was expected: %v", err))
+	}
+}
+
+func TestAreMatchingAbsenceNegation(t *testing.T) {
+
+	testCache = TestEntries{{Response: map[string]interface{}{"id": "123"}}}
+	defer func() { testCache = nil }()
+
+	var testCases = []struct {
+		expected string
+		actual   string
+		match    bool
+	}{
+		{`{"data":"~absent"}`, `{"error":"failed"}`, true},
+		{`{"data":"~absent"}`, `{"error":"failed","data":null}`, false},
+		{`{"data":"~present"}`, `{"data":null}`, true},
+		{`{"data":"~present"}`, `{"data":{}}`, true},
+		{`{"data":"~present"}`, `{}`, false},
+		{`{"data":"~null"}`, `{"data":null}`, true},
+		{`{"data":"~null"}`, `{"data":0}`, false},
+		{`{"data":"~null"}`, `{}`, false},
+		{`{"data":"~not:~absent"}`, `{"data":1}`, true},
+		{`{"data":"~not:~absent"}`, `{}`, false},
+		{`{"data":"~not:~null"}`, `{"data":1}`, true},
+		{`{"data":"~not:null"}`, `{"data":null}`, false},
+		{`{"data":"~not:~re:^[0-9]+$"}`, `{"data":"abc"}`, true},
+		{`{"data":"~not:~re:^[0-9]+$"}`, `{"data":"123"}`, false},
+		{`{"data":"~not:alpha"}`, `{"data":"beta"}`, true},
+		{`{"data":"~not:alpha"}`, `{"data":"alpha"}`, false},
+		{`{"data":"~not:5"}`, `{"data":5}`, false},
+		{`{"data":"~not:\"5\""}`, `{"data":5}`, true},
+		{`{"data":"~not:{\"a\":1}"}`, `{"data":{"a":1,"b":2}}`, false},
+		{`{"id":"~not:~pv:0.Response.id"}`, `{"id":"124"}`, true},
+		{`{"id":"~not:~pv:0.Response.id"}`, `{"id":"123"}`, false},
+		{`{"data":"~not:~not:alpha"}`, `{"data":"alpha"}`, true},
+		{`{"data":"~not:alpha"}`, `{}`, true},
+		{`{"data":"~not:~re:^[0-9]+$"}`, `{}`, true},
+		{`{"id":"~not:~pv:0.Response.id"}`, `{}`, true},
+		{`{"data":"~not:~not:alpha"}`, `{}`, false},
+		{`{"data":"~not:~null"}`, `{}`, true},
+	}
+	for _, tt := range testCases {
+		var expected interface{}
+		var actual interface{}
+		_ = json.Unmarshal([]byte(tt.expected), &expected)
+		_ = json.Unmarshal([]byte(tt.actual), &actual)
+		err := areMatching(expected, actual)
+		if tt.match && err != nil {
+			t.Error(fmt.Errorf("an error was not expected (%s, %s): %v", tt.expected, tt.actual, err))
+		}
+		if !tt.match && err == nil {
+			t.Error(fmt.Errorf("an error was expected (%s, %s)", tt.expected, tt.actual))
+		}
+	}
+}
+
+func TestAreMatchingRegexpGroups(t *testing.T) {
+	testVars = make(map[string]interface{})
+	defer func() { testVars = nil }()
+
+	err := areMatching(map[string]interface{}{"ref": `~re:^REF-(?P<ref>\d+)-(?P<year>\d{4})$`}, map[string]interface{}{"ref": "REF-00123-2017"})
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+	if testVars["ref"] != "00123" || testVars["year"] != "2017" {
+		t.Error(fmt.Errorf("Found different values than expected: %v", testVars))
+	}
+
+	// the variables are set by the paired items
+	var expected interface{}
+	var actual interface{}
+	_ = json.Unmarshal([]byte(`["~unordered",{"id":"~re:^(?P<first>[0-9]+)$","type":"a"},{"id":"~re:^(?P<second>[0-9]+)$"}]`), &expected)
+	_ = json.Unmarshal([]byte(`[{"id":"2","type":"b"},{"id":"1","type":"a"}]`), &actual)
+	err = areMatching(expected, actual)
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+	if testVars["first"] != "1" || testVars["second"] != "2" {
+		t.Error(fmt.Errorf("Found different values than expected: %v", testVars))
+	}
+
+	// the regular expression is invalid
+	err = areMatching("~re:(?P<x", "test")
+	if err == nil {
+		t.Error(fmt.Errorf("an error was expected"))
+	}
+}
+
+func TestProcessCompareDefaultMissing(t *testing.T) {
+	err := processCompareDefault(reflect.ValueOf("~re:[a-z]+"), reflect.Value{})
+	if err == nil || !strings.Contains(err.Error(), "the value is missing") {
+		t.Error(fmt.Errorf("a missing value error was expected, found: %v", err))
+	}
+}
+
+func TestMatchMessagesBareMatcher(t *testing.T) {
+	// the matcher names without argument are compared as simple strings
+	for _, value := range []string{"~re", "~re:", "~tm"} {
+		if err := matchMessages(value, "abc", false); err == nil {
+			t.Error(fmt.Errorf("%q: an error was expected", value))
+		}
+		if err := matchMessages(value, value, false); err != nil {
+			t.Error(fmt.Errorf("%q: an error was not expected: %v", value, err))
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/spf13/viper"
@@ -23,11 +24,13 @@ func (rcfg remoteConfigParams) isEmpty() bool {
 
 // params struct contains the application parameters
 type params struct {
-	log            *LogData   // Log level: EMERGENCY, ALERT, CRITICAL, ERROR, WARNING, NOTICE, INFO, DEBUG.
-	stats          *StatsData // StatsD configuration, it is used to collect usage metrics
-	serverAddress  string     // HTTP API URL (ip:port) or just (:port)
-	natsAddress    string     // NATS bus Address (nats://ip:port)
-	validTransfCmd []string   // list of valid transformation commands
+	log            *LogData          // Log level: EMERGENCY, ALERT, CRITICAL, ERROR, WARNING, NOTICE, INFO, DEBUG.
+	stats          *StatsData        // StatsD configuration, it is used to collect usage metrics
+	serverAddress  string            // HTTP API URL (ip:port) or just (:port)
+	natsAddress    string            // NATS bus Address (nats://ip:port)
+	validTransfCmd []TransfCmd       // list of valid transformation commands
+	jwtKeys        map[string]JWTKey // keys used to sign and verify JSON Web Tokens
+	wasmPlugins    []WasmPlugin      // WebAssembly matcher and transformation plugins
 }
 
 var configDir string
@@ -67,6 +70,8 @@ func getLocalConfigParams() (cfg params, rcfg remoteConfigParams, err error) {
 	viper.SetDefault("serverAddress", ServerAddress)
 	viper.SetDefault("natsAddress", NatsAddress)
 	viper.SetDefault("validTransfCmd", ValidTransfCmd)
+	viper.SetDefault("jwtKeys", map[string]JWTKey{})
+	viper.SetDefault("wasmPlugins", []WasmPlugin{})
 
 	// name of the configuration file without extension
 	viper.SetConfigName("config")
@@ -90,7 +95,10 @@ func getLocalConfigParams() (cfg params, rcfg remoteConfigParams, err error) {
 	}
 
 	// read configuration parameters
-	cfg = getViperParams()
+	cfg, err = getViperParams()
+	if err != nil {
+		return cfg, rcfg, err
+	}
 
 	// support environment variables for the remote configuration
 	viper.AutomaticEnv()
@@ -141,6 +149,8 @@ func getRemoteConfigParams(cfg params, rcfg remoteConfigParams) (params, error)
 	viper.SetDefault("serverAddress", cfg.serverAddress)
 	viper.SetDefault("natsAddress", cfg.natsAddress)
 	viper.SetDefault("validTransfCmd", cfg.validTransfCmd)
+	viper.SetDefault("jwtKeys", cfg.jwtKeys)
+	viper.SetDefault("wasmPlugins", cfg.wasmPlugins)
 
 	// configuration type
 	viper.SetConfigType("json")
@@ -161,11 +171,25 @@ func getRemoteConfigParams(cfg params, rcfg remoteConfigParams) (params, error)
 	}
 
 	// read configuration parameters
-	return getViperParams(), nil
+	return getViperParams()
 }
 
 // getViperParams reads the config params via Viper
-func getViperParams() params {
+func getViperParams() (params, error) {
+	validTransfCmd, err := getTransfCmdList(viper.Get("validTransfCmd"))
+	if err != nil {
+		return params{}, fmt.Errorf("invalid validTransfCmd configuration: %v", err)
+	}
+	var jwtKeys map[string]JWTKey
+	err = viper.UnmarshalKey("jwtKeys", &jwtKeys)
+	if err != nil {
+		return params{}, fmt.Errorf("invalid jwtKeys configuration: %v", err)
+	}
+	var wasmPlugins []WasmPlugin
+	err = viper.UnmarshalKey("wasmPlugins", &wasmPlugins)
+	if err != nil {
+		return params{}, fmt.Errorf("invalid wasmPlugins configuration: %v", err)
+	}
 	return params{
 
 		log: &LogData{
@@ -183,8 +207,10 @@ func getViperParams() params {
 
 		serverAddress:  viper.GetString("serverAddress"),
 		natsAddress:    viper.GetString("natsAddress"),
-		validTransfCmd: viper.GetStringSlice("validTransfCmd"),
-	}
+		validTransfCmd: validTransfCmd,
+		jwtKeys:        jwtKeys,
+		wasmPlugins:    wasmPlugins,
+	}, nil
 }
 
 // checkParams cheks if the configuration parameters are valid
@@ -216,5 +242,41 @@ func checkParams(prm *params) error {
 		return errors.New("natsAddress is empty")
 	}
 
+	// external commands
+	for _, cmd := range prm.validTransfCmd {
+		if cmd.Path == "" {
+			return errors.New("the validTransfCmd path is empty")
+		}
+		if cmd.Timeout < 0 || cmd.MaxOutput < 0 || cmd.MaxStderr < 0 {
+			return fmt.Errorf("the validTransfCmd %s limits must be >= 0", cmd.Path)
+		}
+	}
+
+	// JWT keys
+	for name, key := range prm.jwtKeys {
+		if !isValidJWTAlg(key.Alg) {
+			return fmt.Errorf("the jwtKeys %s alg is not valid: %s", name, key.Alg)
+		}
+		if key.Secret == "" && key.PrivateKeyFile == "" && key.PublicKeyFile == "" && key.JWKSFile == "" {
+			return fmt.Errorf("the jwtKeys %s has no secret or key file", name)
+		}
+		if isHMACJWTAlg(key.Alg) && key.Secret == "" && key.JWKSFile == "" {
+			return fmt.Errorf("the jwtKeys %s requires a secret for the %s algorithm", name, key.Alg)
+		}
+	}
+
+	// WebAssembly plugins
+	for _, plugin := range prm.wasmPlugins {
+		if !pluginName.MatchString(plugin.Name) {
+			return fmt.Errorf("the wasmPlugins name is not valid: %s", plugin.Name)
+		}
+		if plugin.File == "" {
+			return fmt.Errorf("the wasmPlugins %s file is empty", plugin.Name)
+		}
+		if plugin.Timeout < 0 || plugin.MemoryLimit < 0 {
+			return fmt.Errorf("the wasmPlugins %s limits must be >= 0", plugin.Name)
+		}
+	}
+
 	return nil
 }
@@ -24,7 +24,7 @@ func getTestCfgParams() *params {
 		},
 		serverAddress:  ":8081",
 		natsAddress:    "nats://127.0.0.1:4222",
-		validTransfCmd: []string{"/bin/cat", "/bin/echo"},
+		validTransfCmd: []TransfCmd{{Path: "/bin/cat"}, {Path: "/bin/echo", Timeout: 1000}},
 	}
 }
 
@@ -47,6 +47,17 @@ func TestCheckConfigParametersErrors(t *testing.T) {
 		{func(cfg *params) *params { cfg.stats.FlushPeriod = -1; return cfg }, "stats.FlushPeriod"},
 		{func(cfg *params) *params { cfg.serverAddress = ""; return cfg }, "serverAddress"},
 		{func(cfg *params) *params { cfg.natsAddress = ""; return cfg }, "natsAddress"},
+		{func(cfg *params) *params { cfg.validTransfCmd[0].Path = ""; return cfg }, "validTransfCmd.path"},
+		{func(cfg *params) *params { cfg.validTransfCmd[0].Timeout = -1; return cfg }, "validTransfCmd.timeout"},
+		{func(cfg *params) *params {
+			cfg.jwtKeys = map[string]JWTKey{"k": {Alg: "INVALID", Secret: "s"}}
+			return cfg
+		}, "jwtKeys.alg"},
+		{func(cfg *params) *params { cfg.jwtKeys = map[string]JWTKey{"k": {Alg: "HS256"}}; return cfg }, "jwtKeys.secret"},
+		{func(cfg *params) *params {
+			cfg.jwtKeys = map[string]JWTKey{"k": {Alg: "HS256", PublicKeyFile: "hs.pub"}}
+			return cfg
+		}, "jwtKeys.secret"},
 	}
 	for _, tt := range testCases {
 		cfg := getTestCfgParams()
@@ -68,6 +79,12 @@ func TestGetConfigParams(t *testing.T) {
 	if prm.log.Level != "DEBUG" {
 		t.Error(fmt.Errorf("Found different logLevel than expected, found %s", prm.log.Level))
 	}
+	if len(prm.validTransfCmd) != 2 || prm.validTransfCmd[1].Path != "/bin/echo" || prm.validTransfCmd[1].Timeout != 5000 {
+		t.Error(fmt.Errorf("Found different validTransfCmd than expected, found %#v", prm.validTransfCmd))
+	}
+	if prm.jwtKeys["test"].Alg != "HS256" || prm.jwtKeys["test"].Secret != "natstest-secret" {
+		t.Error(fmt.Errorf("Found different jwtKeys than expected, found %#v", prm.jwtKeys))
+	}
 }
 
 func TestGetLocalConfigParams(t *testing.T) {
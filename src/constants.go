@@ -22,6 +22,9 @@ var ConfigPath = [...]string{
 	"/etc/" + ProgramName + "/",
 }
 
+// TestSchemaFile is the JSON schema of the test configuration files, searched in the configuration directories
+const TestSchemaFile = "test.schema.json"
+
 // RemoteConfigProvider is the remote configuration source ("consul", "etcd")
 const RemoteConfigProvider = ""
 
@@ -72,8 +75,48 @@ const NatsAddress = "nats://127.0.0.1:4222"
 // BusTimeout is the default NATS bus connection timeout in seconds
 const BusTimeout = 1
 
+// BusSubscriptionSize is the number of received messages buffered by the subscriptions of the WaitFor test entries
+const BusSubscriptionSize = 64
+
 // ValidTransfCmd contains the default list of valid transformation commands to be used in test configuration templates
 var ValidTransfCmd = []string{
 	"/bin/cat",
 	"/bin/echo",
 }
+
+// RetryMaxDelay is the default maximum delay between the attempts of the test entries with a retry policy, in milliseconds
+const RetryMaxDelay = 60000
+
+// RetryMinDelay is the minimum delay between the attempts of the test entries with a retry policy, in milliseconds,
+// to avoid flooding the bus when the policy has no delay
+const RetryMinDelay = 10
+
+// MaxLoopIterations is the maximum number of iterations of the test entries with a Repeat or ForEach loop
+const MaxLoopIterations = 1000
+
+// RandomMaxLength is the maximum length of the random strings generated by the "~rd:str:" templates
+const RandomMaxLength = 65536
+
+// MaxWaitDelay is the maximum waiting time of the Delay and WaitUntil test entries in milliseconds (1 hour)
+const MaxWaitDelay = 3600000
+
+// TeardownTimeout is the maximum execution time of the teardown entries of a test in milliseconds,
+// after which the remaining waits are stopped
+const TeardownTimeout = 60000
+
+// CmdTimeout is the default maximum execution time of the external commands in milliseconds
+const CmdTimeout = 10000
+
+// CmdMaxOutput is the default maximum size of the standard output of the external commands in bytes
+const CmdMaxOutput = 1048576
+
+// CmdMaxStderr is the default maximum size of the standard error of the external commands captured in the error message, in bytes
+const CmdMaxStderr = 4096
+
+// CmdEnv contains the default names of the environment variables passed to the external commands
+var CmdEnv = []string{
+	"PATH",
+}
+
+// WasmMemoryLimit is the default maximum memory size of the WebAssembly plugins in pages of 64 KiB (16 MiB)
+const WasmMemoryLimit = 256
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// TestRow contains the values of a data row, available as variables during the test run
+type TestRow map[string]interface{}
+
+// loadTestData returns the data rows of the test, reading the data file (if any)
+func loadTestData(def TestFile) ([]TestRow, error) {
+	if def.DataFile == "" {
+		return def.Data, nil
+	}
+	if def.Data != nil {
+		return nil, fmt.Errorf("the data and dataFile fields can't be used together")
+	}
+	path, err := findConfigFile(def.DataFile)
+	if err != nil {
+		return nil, err
+	}
+	/* #nosec */
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rows []TestRow
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		rows, err = decodeCSVData(raw)
+	case ".json":
+		err = json.Unmarshal(raw, &rows)
+		if err != nil {
+			err = getJSONPositionError(raw, err)
+		}
+	case ".yaml", ".yml":
+		var data []byte
+		var enc *yamlEncoder
+		data, enc, err = yamlToJSON(raw)
+		if err == nil {
+			err = json.Unmarshal(data, &rows)
+			if err != nil {
+				err = enc.getPositionError(err)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported data file format (csv, json or yaml): %s", def.DataFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode the data file %s: %v", def.DataFile, err)
+	}
+	return rows, nil
+}
+
+// decodeCSVData decodes the CSV rows, where the first row contains the column names and the values are strings
+func decodeCSVData(raw []byte) ([]TestRow, error) {
+	records, err := csv.NewReader(bytes.NewReader(raw)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("the CSV header is missing")
+	}
+	header := records[0]
+	rows := make([]TestRow, len(records)-1)
+	for i, record := range records[1:] {
+		rows[i] = make(TestRow, len(header))
+		for col, name := range header {
+			rows[i][strings.TrimSpace(name)] = record[col]
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadTestData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "natstest-data")
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	files := map[string]string{
+		"rows.csv":     "currency, amount\nEUR,10\nGBP,20\n",
+		"rows.json":    `[{"currency": "EUR", "amount": 10}, {"currency": "GBP", "amount": 20}]`,
+		"rows.yaml":    "- {currency: EUR, amount: 10}\n- {currency: GBP, amount: 20}\n",
+		"bad.csv":      "a,b\n1\n",
+		"empty.csv":    "",
+		"bad.json":     `{"currency": "EUR"}`,
+		"rows.txt":     "EUR",
+		"invalid.yaml": "- [a",
+	}
+	for name, content := range files {
+		_ = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+	}
+
+	tests := []struct {
+		def      TestFile
+		expected []TestRow
+	}{
+		{TestFile{}, nil},
+		{TestFile{Data: []TestRow{{"currency": "EUR"}}}, []TestRow{{"currency": "EUR"}}},
+		{TestFile{DataFile: filepath.Join(dir, "rows.csv")}, []TestRow{{"currency": "EUR", "amount": "10"}, {"currency": "GBP", "amount": "20"}}},
+		{TestFile{DataFile: filepath.Join(dir, "rows.json")}, []TestRow{{"currency": "EUR", "amount": float64(10)}, {"currency": "GBP", "amount": float64(20)}}},
+		{TestFile{DataFile: filepath.Join(dir, "rows.yaml")}, []TestRow{{"currency": "EUR", "amount": float64(10)}, {"currency": "GBP", "amount": float64(20)}}},
+	}
+	for _, tt := range tests {
+		rows, err := loadTestData(tt.def)
+		if err != nil || !reflect.DeepEqual(rows, tt.expected) {
+			t.Error(fmt.Errorf("found different value than expected: %v %v", rows, err))
+		}
+	}
+
+	for _, def := range []TestFile{
+		{DataFile: filepath.Join(dir, "missing.csv")},
+		{DataFile: filepath.Join(dir, "bad.csv")},
+		{DataFile: filepath.Join(dir, "empty.csv")},
+		{DataFile: filepath.Join(dir, "bad.json")},
+		{DataFile: filepath.Join(dir, "rows.txt")},
+		{DataFile: filepath.Join(dir, "invalid.yaml")},
+		{DataFile: filepath.Join(dir, "rows.csv"), Data: []TestRow{}},
+	} {
+		if _, err := loadTestData(def); err == nil {
+			t.Error(fmt.Errorf("%s: an error was expected", def.DataFile))
+		}
+	}
+}
+
+func TestRunTestData(t *testing.T) {
+	initNatsBus("nats://127.0.0.1:4222")
+	oldTestMap, oldNames, oldDefs := testMap, testNames, testDefs
+	testMap = make(map[string]TestEntries)
+	testNames = make([]string, 0)
+	testDefs = make(map[string]TestFile)
+	defer func() {
+		testMap, testNames, testDefs = oldTestMap, oldNames, oldDefs
+	}()
+
+	err := loadRawJSONTest([]byte(`{
+		"data" : [
+			{"currency" : "EUR", "amount" : 10},
+			{"currency" : "gbp", "amount" : 20},
+			{"currency" : "USD", "amount" : 30}
+		],
+		"steps" : [
+			{
+				"Topic" : "@.data.test",
+				"Request" : {"currency" : "~var:currency", "amount" : "~var:amount"},
+				"Response" : {"currency" : "~re:^[A-Z]{3}$", "amount" : "~tp:{{.vars.amount}}"}
+			}
+		]
+	}`), "rows")
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	results, err := runTest("rows", nil)
+	if err == nil || !strings.HasPrefix(err.Error(), "rows [row 1]: ") {
+		t.Error(fmt.Errorf("a row error was expected, found: %v", err))
+	}
+	if len(results) != 3 {
+		t.Error(fmt.Errorf("expected 3 results, found: %d", len(results)))
+		return
+	}
+	for i, res := range results {
+		if res.Test != "rows" || res.Row == nil || *res.Row != i || (res.Error != "") != (i == 1) {
+			t.Error(fmt.Errorf("found different result than expected: %#v", res))
+		}
+	}
+	if results[2].Data["currency"] != "USD" {
+		t.Error(fmt.Errorf("found different data than expected: %v", results[2].Data))
+	}
+
+	all, err := runTests("all", nil, nil)
+	if err == nil || len(all) != 3 {
+		t.Error(fmt.Errorf("the results of all the rows were expected: %v %v", all, err))
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// TransfCmd contains the configuration and the limits of a valid external command
+type TransfCmd struct {
+	Path      string   `json:"path"`      // full path of the command
+	Timeout   int      `json:"timeout"`   // maximum execution time in milliseconds
+	MaxOutput int      `json:"maxOutput"` // maximum size of the standard output in bytes
+	MaxStderr int      `json:"maxStderr"` // maximum size of the standard error captured in the error message, in bytes
+	Env       []string `json:"env"`       // names of the environment variables passed to the command
+	Dir       string   `json:"dir"`       // working directory
+}
+
+// validTransfCmds contains the valid external commands indexed by path
+var validTransfCmds = make(map[string]TransfCmd)
+
+// limitedBuffer is a buffer that discards the data exceeding the maximum size
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	max      int
+	exceeded bool
+}
+
+// Write stores the data up to the maximum size
+func (lb *limitedBuffer) Write(p []byte) (int, error) {
+	if free := lb.max - lb.buf.Len(); len(p) > free {
+		lb.exceeded = true
+		if free > 0 {
+			lb.buf.Write(p[:free])
+		}
+		// report the full length to avoid breaking the command pipe
+		return len(p), nil
+	}
+	return lb.buf.Write(p)
+}
+
+// setValidTransfCmds sets the list of valid external commands
+func setValidTransfCmds(cmds []TransfCmd) {
+	validTransfCmds = make(map[string]TransfCmd)
+	for _, cmd := range cmds {
+		validTransfCmds[cmd.Path] = cmd
+	}
+}
+
+// getTransfCmd returns the configuration of the valid command with the default limits, or false if the command is not valid
+func getTransfCmd(path string) (TransfCmd, bool) {
+	cmd, ok := validTransfCmds[path]
+	if cmd.Timeout <= 0 {
+		cmd.Timeout = CmdTimeout
+	}
+	if cmd.MaxOutput <= 0 {
+		cmd.MaxOutput = CmdMaxOutput
+	}
+	if cmd.MaxStderr <= 0 {
+		cmd.MaxStderr = CmdMaxStderr
+	}
+	if cmd.Env == nil {
+		cmd.Env = CmdEnv
+	}
+	return cmd, ok
+}
+
+// execCommand executes a valid external command within its limits and returns the standard output
+func execCommand(path string, args ...string) ([]byte, error) {
+	cfg, ok := getTransfCmd(path)
+	if !ok {
+		return nil, fmt.Errorf("the following command is not valid: %v", path)
+	}
+	/* #nosec */
+	cmd := exec.Command(path, args...)
+	cmd.Dir = cfg.Dir
+	cmd.Env = getCommandEnv(cfg.Env)
+	// the command runs in its own process group, so any child process can be killed after the timeout
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	stdout := &limitedBuffer{max: cfg.MaxOutput}
+	stderr := &limitedBuffer{max: cfg.MaxStderr}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("%v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	timer := time.NewTimer(time.Duration(cfg.Timeout) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case err = <-done:
+	case <-timer.C:
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		return nil, fmt.Errorf("the command %v timed out after %d ms", path, cfg.Timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.buf.String()))
+	}
+	if stdout.exceeded {
+		return nil, fmt.Errorf("the output of the command %v exceeds the limit of %d bytes", path, cfg.MaxOutput)
+	}
+	return stdout.buf.Bytes(), nil
+}
+
+// getCommandEnv returns the allowed environment variables in the "key=value" format
+func getCommandEnv(names []string) []string {
+	env := []string{}
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// getTransfCmdList decodes the list of valid commands, where each item can be the command path or an object with the command limits
+func getTransfCmdList(list interface{}) ([]TransfCmd, error) {
+	raw, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+	var items []json.RawMessage
+	err = json.Unmarshal(raw, &items)
+	if err != nil {
+		return nil, fmt.Errorf("the list of valid commands must be an array: %v", err)
+	}
+	cmds := make([]TransfCmd, len(items))
+	for i, item := range items {
+		if len(item) > 0 && item[0] == '"' {
+			err = json.Unmarshal(item, &cmds[i].Path)
+		} else {
+			err = json.Unmarshal(item, &cmds[i])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid command %s: %v", item, err)
+		}
+	}
+	return cmds, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setTestTransfCmds() func() {
+	old := validTransfCmds
+	setValidTransfCmds([]TransfCmd{
+		{Path: "/bin/echo", MaxOutput: 8},
+		{Path: "/bin/cat"},
+		{Path: "/bin/sleep", Timeout: 100},
+		{Path: "/bin/sh", Timeout: 100},
+		{Path: "/bin/pwd", Dir: "/tmp"},
+		{Path: "/usr/bin/env", Env: []string{"NATSTEST_EXEC_ALLOWED"}},
+	})
+	return func() { validTransfCmds = old }
+}
+
+func TestExecCommand(t *testing.T) {
+	defer setTestTransfCmds()()
+
+	out, err := execCommand("/bin/echo", "-n", "hello")
+	if err != nil || string(out) != "hello" {
+		t.Error(fmt.Errorf("found different value than expected: %q %v", out, err))
+	}
+
+	out, err = execCommand("/bin/pwd")
+	if err != nil || strings.TrimSpace(string(out)) != "/tmp" {
+		t.Error(fmt.Errorf("found different value than expected: %q %v", out, err))
+	}
+
+	_ = os.Setenv("NATSTEST_EXEC_ALLOWED", "yes")
+	_ = os.Setenv("NATSTEST_EXEC_DENIED", "no")
+	defer func() {
+		_ = os.Unsetenv("NATSTEST_EXEC_ALLOWED")
+		_ = os.Unsetenv("NATSTEST_EXEC_DENIED")
+	}()
+	out, err = execCommand("/usr/bin/env")
+	if err != nil || strings.TrimSpace(string(out)) != "NATSTEST_EXEC_ALLOWED=yes" {
+		t.Error(fmt.Errorf("found different value than expected: %q %v", out, err))
+	}
+}
+
+func TestExecCommandErrors(t *testing.T) {
+	defer setTestTransfCmds()()
+
+	_, err := execCommand("/bin/ls", "/")
+	if err == nil || !strings.Contains(err.Error(), "not valid") {
+		t.Error(fmt.Errorf("an invalid command error was expected, found: %v", err))
+	}
+
+	start := time.Now()
+	_, err = execCommand("/bin/sleep", "5")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Error(fmt.Errorf("a timeout error was expected, found: %v", err))
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error(fmt.Errorf("the command was not stopped after the timeout"))
+	}
+
+	// the child processes holding the output pipe are also stopped
+	start = time.Now()
+	_, err = execCommand("/bin/sh", "-c", "sleep 5 & sleep 5")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Error(fmt.Errorf("a timeout error was expected, found: %v", err))
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error(fmt.Errorf("the child processes were not stopped after the timeout"))
+	}
+
+	_, err = execCommand("/bin/echo", "a long output string")
+	if err == nil || !strings.Contains(err.Error(), "exceeds the limit of 8 bytes") {
+		t.Error(fmt.Errorf("an output limit error was expected, found: %v", err))
+	}
+
+	_, err = execCommand("/bin/cat", "/missing/file")
+	if err == nil || !strings.Contains(err.Error(), "/missing/file") {
+		t.Error(fmt.Errorf("the standard error was expected in the error message, found: %v", err))
+	}
+}
+
+func TestGetTransfCmdList(t *testing.T) {
+	cmds, err := getTransfCmdList([]interface{}{
+		"/bin/cat",
+		map[string]interface{}{"path": "/bin/echo", "timeout": 500, "env": []string{"HOME"}},
+	})
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	if len(cmds) != 2 || cmds[0].Path != "/bin/cat" || cmds[1].Timeout != 500 || cmds[1].Env[0] != "HOME" {
+		t.Error(fmt.Errorf("found different value than expected: %#v", cmds))
+	}
+	_, err = getTransfCmdList("/bin/cat")
+	if err == nil {
+		t.Error(fmt.Errorf("an error was expected"))
+	}
+	_, err = getTransfCmdList([]interface{}{map[string]interface{}{"timeout": "x"}})
+	if err == nil {
+		t.Error(fmt.Errorf("an error was expected"))
+	}
+}
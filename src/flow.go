@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/google/cel-go/cel"
+)
+
+// loopItemVar is the name of the test variable containing the current item of a ForEach loop
+const loopItemVar = "item"
+
+// loopIndexVar is the name of the test variable containing the index of the current Repeat or ForEach iteration
+const loopIndexVar = "index"
+
+// testSkipped contains the names of the entries skipped in the current test because their When condition was false
+var testSkipped []string
+
+// checkFlowControls returns an error if a When condition or a loop of the test is not valid
+func checkFlowControls(def TestFile) error {
+	for _, entries := range []TestEntries{def.Setup, def.Steps, def.Teardown} {
+		for _, msg := range entries {
+			if err := checkFlowControl(msg); err != nil {
+				return fmt.Errorf("%s: %v", msg.Source, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkFlowControl returns an error if the When condition or the loop of the test entry is not valid
+func checkFlowControl(msg TestEntry) error {
+	if msg.Repeat < 0 || msg.Repeat > MaxLoopIterations {
+		return fmt.Errorf("the repeat value must be between 0 and %d", MaxLoopIterations)
+	}
+	if msg.Repeat > 0 && msg.ForEach != "" {
+		return fmt.Errorf("the repeat and forEach options are mutually exclusive")
+	}
+	if err := checkWaitStep(msg); err != nil {
+		return err
+	}
+	if msg.When == "" {
+		return nil
+	}
+	_, err := compileCondition(msg.When)
+	return err
+}
+
+// compileCondition compiles a When condition using the same environment of the assertions
+func compileCondition(expr string) (cel.Program, error) {
+	env, err := getAssertEnv()
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize the condition environment: %v", err)
+	}
+	checked, iss := env.Compile(expr)
+	if iss != nil && iss.Err() != nil {
+		return nil, fmt.Errorf("invalid condition %q: %v", expr, iss.Err())
+	}
+	prg, err := env.Program(checked)
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition %q: %v", expr, err)
+	}
+	return prg, nil
+}
+
+// checkCondition evaluates the When condition of the specified step, returning true if the step must be executed
+func checkCondition(expr string, item int) (bool, error) {
+	if expr == "" {
+		return true, nil
+	}
+	prg, err := compileCondition(expr)
+	if err != nil {
+		return false, err
+	}
+	out, _, err := prg.Eval(getAssertData(item))
+	if err != nil {
+		return false, fmt.Errorf("unable to evaluate the condition %q: %v", expr, err)
+	}
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("the condition %q does not return a boolean value", expr)
+	}
+	return result, nil
+}
+
+// getLoopItems returns the list of items of a ForEach loop, resolving the template (e.g. "~pv:list.Response.items")
+func getLoopItems(forEach string) ([]interface{}, error) {
+	value, err := replaceTemplates(forEach)
+	if err != nil {
+		return nil, fmt.Errorf("unable to process the forEach template %s: %v", forEach, err)
+	}
+	if value == nil {
+		return nil, nil
+	}
+	list := reflect.ValueOf(value)
+	if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return nil, fmt.Errorf("the forEach value %s is not an array: %v", forEach, value)
+	}
+	if list.Len() > MaxLoopIterations {
+		return nil, fmt.Errorf("the forEach array %s contains %d items (max %d)", forEach, list.Len(), MaxLoopIterations)
+	}
+	items := make([]interface{}, list.Len())
+	for i := range items {
+		items[i] = list.Index(i).Interface()
+	}
+	return items, nil
+}
+
+// getStepName returns the name of the test entry, or the topic and the index if the name is empty
+func getStepName(msg TestEntry, item int) string {
+	if msg.Name != "" {
+		return msg.Name
+	}
+	return fmt.Sprintf("%s [%d]", msg.Topic, item)
+}
+
+// execTestStep executes a test entry once, or once for each iteration of its Repeat or ForEach loop,
+// skipping the executions where the When condition is false.
+// Each iteration overwrites the same position of the test cache, so the later steps see the last processed messages.
+func execTestStep(msg TestEntry, item int, defaults TestDefaults) (err error) {
+	testCache[item].Name = msg.Name
+	testCache[item].Topic = msg.Topic
+
+	if msg.Repeat == 0 && msg.ForEach == "" {
+		run, err := checkCondition(msg.When, item)
+		if err != nil {
+			return fmt.Errorf("%s [%d]: %v", msg.Topic, item, err)
+		}
+		if !run {
+			testSkipped = append(testSkipped, getStepName(msg, item))
+			return nil
+		}
+		return execTestEntry(msg, item, defaults)
+	}
+
+	var items []interface{}
+	count := msg.Repeat
+	if msg.ForEach != "" {
+		items, err = getLoopItems(msg.ForEach)
+		if err != nil {
+			return fmt.Errorf("%s [%d]: %v", msg.Topic, item, err)
+		}
+		count = len(items)
+	}
+
+	// the loop variables are restored at the end, so they do not leak into the following steps
+	prevItem, hasItem := testVars[loopItemVar]
+	prevIndex, hasIndex := testVars[loopIndexVar]
+	defer func() {
+		restoreVariable(loopItemVar, prevItem, hasItem)
+		restoreVariable(loopIndexVar, prevIndex, hasIndex)
+	}()
+
+	executed := 0
+	for idx := 0; idx < count; idx++ {
+		if err = checkTestRun(); err != nil {
+			return fmt.Errorf("%s [%d] [iteration %d]: %v", msg.Topic, item, idx, err)
+		}
+		testVars[loopIndexVar] = idx
+		if items != nil {
+			testVars[loopItemVar] = items[idx]
+		}
+		run, err := checkCondition(msg.When, item)
+		if err != nil {
+			return fmt.Errorf("%s [%d] [iteration %d]: %v", msg.Topic, item, idx, err)
+		}
+		if !run {
+			continue
+		}
+		executed++
+		err = execTestEntry(msg, item, defaults)
+		if err != nil {
+			return fmt.Errorf("%v [iteration %d]", err, idx)
+		}
+	}
+	if executed == 0 {
+		testSkipped = append(testSkipped, getStepName(msg, item))
+	}
+	return nil
+}
+
+// restoreVariable sets the previous value of a test variable, or removes it if it did not exist
+func restoreVariable(name string, value interface{}, exist bool) {
+	if exist {
+		testVars[name] = value
+		return
+	}
+	delete(testVars, name)
+}
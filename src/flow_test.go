@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCheckFlowControls(t *testing.T) {
+	valid := []TestEntry{{When: "vars.exists == false"}, {Repeat: 3}, {ForEach: "~pv:list.Response.items", When: "vars.item.active"}}
+	for _, msg := range valid {
+		if err := checkFlowControls(TestFile{Steps: TestEntries{msg}}); err != nil {
+			t.Error(fmt.Errorf("%+v: an error was not expected: %v", msg, err))
+		}
+	}
+	invalid := []TestEntry{{When: "vars.exists =="}, {Repeat: -1}, {Repeat: MaxLoopIterations + 1}, {Repeat: 2, ForEach: "~var:items"}}
+	for _, msg := range invalid {
+		msg.Source = "test_x.json:steps[0]"
+		if err := checkFlowControls(TestFile{Steps: TestEntries{msg}}); err == nil || !strings.HasPrefix(err.Error(), "test_x.json:steps[0]: ") {
+			t.Error(fmt.Errorf("%+v: an error was expected, found: %v", msg, err))
+		}
+	}
+}
+
+func TestGetLoopItems(t *testing.T) {
+	testVars = map[string]interface{}{
+		"list":  []interface{}{"a", "b"},
+		"obj":   map[string]interface{}{"a": 1},
+		"large": make([]interface{}, MaxLoopIterations+1),
+	}
+	items, err := getLoopItems("~var:list")
+	if err != nil || len(items) != 2 || items[1] != "b" {
+		t.Error(fmt.Errorf("found different items than expected: %v %v", items, err))
+	}
+	items, err = getLoopItems("~var:missing")
+	if err != nil || len(items) != 0 {
+		t.Error(fmt.Errorf("no items were expected: %v %v", items, err))
+	}
+	for _, forEach := range []string{"~var:obj", "~var:large"} {
+		if _, err = getLoopItems(forEach); err == nil {
+			t.Error(fmt.Errorf("%s: an error was expected", forEach))
+		}
+	}
+}
+
+func TestExecTestFlow(t *testing.T) {
+	initNatsBus("nats://127.0.0.1:4222")
+	def := TestFile{Steps: TestEntries{
+		{
+			Name:     "list",
+			Topic:    "@.flow.test",
+			Request:  map[string]interface{}{"items": []interface{}{map[string]interface{}{"id": 1.0}, map[string]interface{}{"id": 2.0}, map[string]interface{}{"id": 3.0}}},
+			Response: map[string]interface{}{"items": "~re:.*"},
+		},
+		{
+			Name:     "register",
+			Topic:    "@.flow.test",
+			When:     "vars.exists == false",
+			Request:  map[string]interface{}{"user": "alice"},
+			Response: map[string]interface{}{"user": "alice"},
+		},
+		{
+			Name:     "each",
+			Topic:    "@.flow.test",
+			ForEach:  "~pv:list.Response.items",
+			When:     "vars.item.id != 2.0",
+			Request:  map[string]interface{}{"id": "~var:item.id", "index": "~var:index"},
+			Response: map[string]interface{}{"id": "~var:item.id"},
+			Capture:  map[string]string{"last": "Response.id"},
+		},
+		{
+			Name:     "repeat",
+			Topic:    "@.flow.test",
+			Repeat:   2,
+			Request:  map[string]interface{}{"index": "~var:index"},
+			Response: map[string]interface{}{"index": "~var:index"},
+		},
+	}}
+
+	err := execTestFile(def, TestRow{"exists": true})
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+	if len(testSkipped) != 1 || testSkipped[0] != "register" || testCache[1].Topic != "@.flow.test" || testCache[1].Request != nil {
+		t.Error(fmt.Errorf("the register step was expected to be skipped: %v", testSkipped))
+	}
+	if testVars["last"] != 3.0 {
+		t.Error(fmt.Errorf("the last iteration was expected to be captured: %v", testVars["last"]))
+	}
+	if _, ok := testVars[loopItemVar]; ok {
+		t.Error(fmt.Errorf("the loop variables were not expected after the loop"))
+	}
+	resp, ok := testCache[3].Response.(map[string]interface{})
+	if !ok {
+		t.Fatalf("the repeat response was expected in the cache: %#v", testCache[3].Response)
+	}
+	if resp["index"] != 1.0 {
+		t.Error(fmt.Errorf("the last repeat iteration was expected in the cache: %v", testCache[3].Response))
+	}
+
+	err = execTestFile(def, TestRow{"exists": false})
+	if err != nil || len(testSkipped) != 0 {
+		t.Error(fmt.Errorf("no skipped steps were expected: %v %v", testSkipped, err))
+	}
+
+	def.Steps[2].Response = map[string]interface{}{"id": 1.0}
+	err = execTestFile(def, TestRow{"exists": true})
+	if err == nil || !strings.HasSuffix(err.Error(), "[iteration 2]") {
+		t.Error(fmt.Errorf("an iteration error was expected, found: %v", err))
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// fragmentArgPrefix is the prefix of the values replaced with the fragment arguments when the fragment is included (e.g. "~arg:user")
+const fragmentArgPrefix = "~arg:"
+
+// TestFragment defines a reusable sequence of test entries that can be included with parameters
+type TestFragment struct {
+	Params TestParams  `json:"params"` // fragment parameters, referenced in the entries as "~arg:NAME"
+	Steps  TestEntries `json:"steps"`  // sequence of test entries
+	source string      // location of the fragment definition (e.g. "fragment_login.json")
+}
+
+// testFragments contains the fragments defined in the fragment files, indexed by name
+var testFragments map[string]TestFragment
+
+// UnmarshalJSON decodes a fragment defined either as a list of test entries or as an object with parameters
+func (frag *TestFragment) UnmarshalJSON(data []byte) error {
+	if len(bytes.TrimSpace(data)) > 0 && bytes.TrimSpace(data)[0] == '[' {
+		return json.Unmarshal(data, &frag.Steps)
+	}
+	type fragment TestFragment // avoid the recursion
+	return json.Unmarshal(data, (*fragment)(frag))
+}
+
+// loadRawFragment decodes the fragment from the JSON or YAML string (depending on the source file extension)
+// and stores it in the specified fragment registry
+func loadRawFragment(raw []byte, name string, source string, fragments map[string]TestFragment) error {
+	data, err := decodeRawTest(raw, source)
+	if err != nil {
+		return err
+	}
+	fragments[name] = TestFragment{Params: data.Params, Steps: data.Steps, source: source}
+	return nil
+}
+
+// expandTestFile replaces the include entries of the setup, main and teardown sections with the fragment entries,
+// searching the fragment files in the specified registry
+func expandTestFile(def TestFile, source string, fragments map[string]TestFragment) (TestFile, error) {
+	for name, frag := range def.Fragments {
+		frag.source = source + ":fragments." + name
+		def.Fragments[name] = frag
+	}
+	var err error
+	def.Setup, err = expandIncludes(def.Setup, def.Fragments, fragments, source+":setup", nil)
+	if err != nil {
+		return def, err
+	}
+	def.Steps, err = expandIncludes(def.Steps, def.Fragments, fragments, source+":steps", nil)
+	if err != nil {
+		return def, err
+	}
+	def.Teardown, err = expandIncludes(def.Teardown, def.Fragments, fragments, source+":teardown", nil)
+	return def, err
+}
+
+// expandIncludes recursively replaces the include entries with the fragment entries, where the local fragments have priority
+// over the fragment files; the stack contains the names of the fragments being expanded, to detect the include cycles
+func expandIncludes(entries TestEntries, local map[string]TestFragment, fragments map[string]TestFragment, location string, stack []string) (TestEntries, error) {
+	if entries == nil {
+		return nil, nil
+	}
+	expanded := TestEntries{}
+	for item, entry := range entries {
+		loc := fmt.Sprintf("%s[%d]", location, item)
+		if entry.Include == "" {
+			if entry.With != nil {
+				return nil, fmt.Errorf("%s: the With parameters require the Include field", loc)
+			}
+			entry.Source = loc
+			expanded = append(expanded, entry)
+			continue
+		}
+		if entry.Topic != "" {
+			return nil, fmt.Errorf("%s: an include entry can't contain a Topic", loc)
+		}
+		for _, name := range stack {
+			if name == entry.Include {
+				return nil, fmt.Errorf("%s: include cycle: %s > %s", loc, strings.Join(stack, " > "), entry.Include)
+			}
+		}
+		// the nested includes are resolved in the scope of the file defining the fragment:
+		// the fragment files can only include other fragment files
+		scope := local
+		frag, ok := local[entry.Include]
+		if !ok {
+			scope = nil
+			frag, ok = fragments[entry.Include]
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s: unable to find the fragment %s", loc, entry.Include)
+		}
+		args, err := getFragmentArgs(frag.Params, entry.With)
+		if err != nil {
+			return nil, fmt.Errorf("%s: fragment %s: %v", loc, entry.Include, err)
+		}
+		steps := make(TestEntries, len(frag.Steps))
+		for i, step := range frag.Steps {
+			steps[i], err = replaceFragmentArgs(step, args)
+			if err != nil {
+				return nil, fmt.Errorf("%s: fragment %s: %s:steps[%d]: %v", loc, entry.Include, frag.source, i, err)
+			}
+		}
+		steps, err = expandIncludes(steps, scope, fragments, frag.source+":steps", append(stack, entry.Include))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", loc, err)
+		}
+		for i := range steps {
+			steps[i].Source = loc + " > " + steps[i].Source
+		}
+		expanded = append(expanded, steps...)
+	}
+	return expanded, nil
+}
+
+// getFragmentArgs returns the values of the fragment parameters, applying the default values and checking the required parameters;
+// the optional parameters without a default value are null
+func getFragmentArgs(defs TestParams, with map[string]interface{}) (map[string]interface{}, error) {
+	args := make(map[string]interface{})
+	for key, def := range defs {
+		args[key] = def.Default
+	}
+	var unknown, missing []string
+	for key, value := range with {
+		if _, ok := defs[key]; !ok {
+			unknown = append(unknown, key)
+		}
+		args[key] = value
+	}
+	for key, def := range defs {
+		if _, ok := with[key]; def.Required && !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown parameters: %s", strings.Join(unknown, ", "))
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("missing required parameters: %s", strings.Join(missing, ", "))
+	}
+	return args, nil
+}
+
+// replaceFragmentArgs returns a copy of the fragment entry where the "~arg:NAME" values are replaced with the fragment arguments
+// in all the fields; the arguments replacing a string field are converted to string (JSON-encoded for objects and arrays)
+func replaceFragmentArgs(entry TestEntry, args map[string]interface{}) (TestEntry, error) {
+	copy := reflect.New(reflect.TypeOf(entry)).Elem()
+	err := processFragmentArgs(copy, reflect.ValueOf(entry), args)
+	if err != nil {
+		return entry, err
+	}
+	return copy.Interface().(TestEntry), nil
+}
+
+// processFragmentArgs recursively copies the original value replacing the fragment arguments, in the same way as processTemplates
+func processFragmentArgs(copy, original reflect.Value, args map[string]interface{}) error {
+	switch original.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Ptr, reflect.Interface:
+		if original.IsNil() {
+			return nil
+		}
+		value := original.Elem()
+		if original.Kind() == reflect.Interface && value.Kind() == reflect.String {
+			arg, ok, err := getFragmentArg(value.String(), args)
+			if err != nil || ok {
+				if arg != nil {
+					copy.Set(reflect.ValueOf(arg))
+				}
+				return err
+			}
+		}
+		copyValue := reflect.New(value.Type()).Elem()
+		if err := processFragmentArgs(copyValue, value, args); err != nil {
+			return err
+		}
+		if original.Kind() == reflect.Ptr {
+			copyValue = copyValue.Addr()
+		}
+		copy.Set(copyValue)
+	case reflect.Struct:
+		for i := 0; i < original.NumField(); i++ {
+			if err := processFragmentArgs(copy.Field(i), original.Field(i), args); err != nil {
+				return fmt.Errorf("%s: %v", original.Type().Field(i).Name, err)
+			}
+		}
+	case reflect.Slice:
+		if original.IsNil() {
+			return nil
+		}
+		copy.Set(reflect.MakeSlice(original.Type(), original.Len(), original.Len()))
+		for i := 0; i < original.Len(); i++ {
+			if err := processFragmentArgs(copy.Index(i), original.Index(i), args); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if original.IsNil() {
+			return nil
+		}
+		copy.Set(reflect.MakeMap(original.Type()))
+		for _, key := range original.MapKeys() {
+			value := original.MapIndex(key)
+			copyValue := reflect.New(value.Type()).Elem()
+			if err := processFragmentArgs(copyValue, value, args); err != nil {
+				return err
+			}
+			copy.SetMapIndex(key, copyValue)
+		}
+	case reflect.String:
+		arg, ok, err := getFragmentArg(original.String(), args)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			copy.Set(original)
+			return nil
+		}
+		str, err := getFragmentArgString(arg)
+		if err != nil {
+			return err
+		}
+		copy.SetString(str)
+	default:
+		copy.Set(original)
+	}
+	return nil
+}
+
+// getFragmentArg returns the fragment argument and true if the value is in the form "~arg:NAME",
+// or an error if the fragment does not define the parameter
+func getFragmentArg(value string, args map[string]interface{}) (interface{}, bool, error) {
+	if !strings.HasPrefix(value, fragmentArgPrefix) {
+		return nil, false, nil
+	}
+	name := value[len(fragmentArgPrefix):]
+	arg, ok := args[name]
+	if !ok {
+		return nil, true, fmt.Errorf("unknown fragment parameter: %s", name)
+	}
+	return arg, true, nil
+}
+
+// getFragmentArgString converts a fragment argument to string, using the JSON encoding for the values that are not strings
+func getFragmentArgString(arg interface{}) (string, error) {
+	switch v := arg.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	raw, err := json.Marshal(arg)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode the fragment argument %v: %v", arg, err)
+	}
+	return string(raw), nil
+}
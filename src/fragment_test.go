@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandIncludes(t *testing.T) {
+	fragments := make(map[string]TestFragment)
+
+	err := loadRawFragment([]byte(`{
+		"params" : {"user" : {"required" : true}, "role" : {"default" : "admin"}},
+		"steps" : [
+			{"Name" : "login-~arg:user", "Topic" : "auth.login", "Request" : {"user" : "~arg:user", "roles" : ["~arg:role"]}, "Response" : {"token" : "~present"}}
+		]
+	}`), "login", "fragment_login.json", fragments)
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+
+	def, err := decodeYAMLTest([]byte(`
+fragments:
+  session:
+    params: {user: {required: true}}
+    steps:
+      - Include: login
+        With: {user: "~arg:user"}
+      - Topic: session.open
+        Request: {user: "~arg:user", currency: "~pm:currency", name: "~pm:user"}
+steps:
+  - Topic: health
+  - Include: session
+    With: {user: bob}
+`))
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	def, err = expandTestFile(def, "test_orders.yaml", fragments)
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	if len(def.Steps) != 3 {
+		t.Error(fmt.Errorf("expected 3 steps, found %d", len(def.Steps)))
+		return
+	}
+	login := def.Steps[1]
+	if login.Name != "login-~arg:user" || fmt.Sprint(login.Request) != "map[roles:[admin] user:bob]" {
+		t.Error(fmt.Errorf("found different value than expected: %#v", login))
+	}
+	if login.Source != "test_orders.yaml:steps[1] > test_orders.yaml:fragments.session:steps[0] > fragment_login.json:steps[0]" {
+		t.Error(fmt.Errorf("found different source than expected: %s", login.Source))
+	}
+	// the test parameters are resolved at run time, even if the fragment has a parameter with the same name
+	if fmt.Sprint(def.Steps[2].Request) != "map[currency:~pm:currency name:~pm:user user:bob]" || def.Steps[0].Source != "test_orders.yaml:steps[0]" {
+		t.Error(fmt.Errorf("found different value than expected: %#v", def.Steps[2]))
+	}
+
+	tests := []struct {
+		raw      string
+		expected string
+	}{
+		{`[{"Include" : "missing"}]`, "test_x.json:steps[0]: unable to find the fragment missing"},
+		{`[{"Include" : "login"}]`, "test_x.json:steps[0]: fragment login: missing required parameters: user"},
+		{`[{"Include" : "login", "With" : {"user" : "a", "other" : 1}}]`, "unknown parameters: other"},
+		{`[{"Include" : "login", "Topic" : "a"}]`, "an include entry can't contain a Topic"},
+		{`[{"Topic" : "a", "With" : {"user" : "a"}}]`, "the With parameters require the Include field"},
+		{`{"fragments" : {"a" : [{"Topic" : "~arg:missing"}]}, "steps" : [{"Include" : "a"}]}`,
+			"test_x.json:steps[0]: fragment a: test_x.json:fragments.a:steps[0]: Topic: unknown fragment parameter: missing"},
+		{`{"fragments" : {"a" : [{"Include" : "b"}], "b" : [{"Include" : "a"}]}, "teardown" : [{"Include" : "a"}]}`,
+			"test_x.json:teardown[0]: test_x.json:fragments.a:steps[0]: test_x.json:fragments.b:steps[0]: include cycle: a > b > a"},
+	}
+	for _, tt := range tests {
+		def, err = decodeRawTest([]byte(tt.raw), "test_x.json")
+		if err == nil {
+			_, err = expandTestFile(def, "test_x.json", fragments)
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Error(fmt.Errorf("the error should contain %q, found: %v", tt.expected, err))
+		}
+	}
+}
+
+func TestReplaceFragmentArgs(t *testing.T) {
+	entry := TestEntry{
+		Name:      "~arg:name",
+		WaitFor:   "~arg:subject",
+		WaitUntil: "~arg:until",
+		When:      "~arg:enabled",
+		ForEach:   "~arg:items",
+		Schema:    "~arg:schema",
+		Assert:    []string{"~arg:assert", "size(response) > 0"},
+		Capture:   map[string]string{"id": "~arg:path"},
+		Response:  map[string]interface{}{"id": "~arg:id", "tags": []interface{}{"~arg:tag"}, "none": "~arg:none"},
+		Retry:     &TestRetry{MaxAttempts: 3},
+	}
+	args := map[string]interface{}{
+		"name": "wait", "subject": "orders.shipped", "until": "~var:until", "enabled": true, "items": "~pv:list.Response.items",
+		"schema": "order.schema.json", "assert": "response.id == 1", "path": "Response.id", "id": 1.0, "tag": map[string]interface{}{"a": 1}, "none": nil,
+	}
+	out, err := replaceFragmentArgs(entry, args)
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	expected := TestEntry{
+		Name:      "wait",
+		WaitFor:   "orders.shipped",
+		WaitUntil: "~var:until",
+		When:      "true",
+		ForEach:   "~pv:list.Response.items",
+		Schema:    "order.schema.json",
+		Assert:    []string{"response.id == 1", "size(response) > 0"},
+		Capture:   map[string]string{"id": "Response.id"},
+		Response:  map[string]interface{}{"id": 1.0, "tags": []interface{}{map[string]interface{}{"a": 1}}, "none": nil},
+		Retry:     &TestRetry{MaxAttempts: 3},
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Error(fmt.Errorf("found different value than expected: %#v", out))
+	}
+	if out.Retry == entry.Retry || entry.Assert[0] != "~arg:assert" || entry.Capture["id"] != "~arg:path" {
+		t.Error(fmt.Errorf("the original entry was expected to be unchanged: %#v", entry))
+	}
+	_, err = replaceFragmentArgs(TestEntry{Capture: map[string]string{"id": "~arg:other"}}, args)
+	if err == nil || err.Error() != "Capture: unknown fragment parameter: other" {
+		t.Error(fmt.Errorf("an unknown parameter error was expected, found: %v", err))
+	}
+}
+
+func TestExpandIncludesScope(t *testing.T) {
+	fragments := make(map[string]TestFragment)
+
+	// the file fragments include the file fragment "step", even if the test defines a local fragment with the same name
+	err := loadRawFragment([]byte(`[{"Include" : "step"}]`), "outer", "fragment_outer.json", fragments)
+	if err == nil {
+		err = loadRawFragment([]byte(`[{"Topic" : "file.step"}]`), "step", "fragment_step.json", fragments)
+	}
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	def, err := decodeRawTest([]byte(`{
+		"fragments" : {"step" : [{"Topic" : "local.step"}], "inner" : [{"Include" : "step"}]},
+		"steps" : [{"Include" : "outer"}, {"Include" : "inner"}]
+	}`), "test_scope.json")
+	if err == nil {
+		def, err = expandTestFile(def, "test_scope.json", fragments)
+	}
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	if len(def.Steps) != 2 || def.Steps[0].Topic != "file.step" || def.Steps[1].Topic != "local.step" {
+		t.Error(fmt.Errorf("found different steps than expected: %#v", def.Steps))
+	}
+
+	// a fragment file can't include the local fragments of a test
+	delete(fragments, "step")
+	def, _ = decodeRawTest([]byte(`{"fragments" : {"step" : [{"Topic" : "local.step"}]}, "steps" : [{"Include" : "outer"}]}`), "test_scope.json")
+	_, err = expandTestFile(def, "test_scope.json", fragments)
+	if err == nil || !strings.Contains(err.Error(), "fragment_outer.json:steps[0]: unable to find the fragment step") {
+		t.Error(fmt.Errorf("a missing fragment error was expected, found: %v", err))
+	}
+}
+
+func TestRunTestFragmentSource(t *testing.T) {
+	initNatsBus("nats://127.0.0.1:4222")
+	oldTestMap, oldNames, oldDefs := testMap, testNames, testDefs
+	testMap = make(map[string]TestEntries)
+	testNames = make([]string, 0)
+	testDefs = make(map[string]TestFile)
+	defer func() {
+		testMap, testNames, testDefs = oldTestMap, oldNames, oldDefs
+	}()
+
+	err := loadRawJSONTest([]byte(`{
+		"fragments" : {
+			"check" : {
+				"params" : {"expected" : {}},
+				"steps" : [{"Topic" : "@.fragment.source", "Request" : {"value" : 1}, "Response" : {"value" : "~arg:expected"}}]
+			}
+		},
+		"steps" : [{"Include" : "check", "With" : {"expected" : 2}}]
+	}`), "source")
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	_, err = runTest("source", nil)
+	if err == nil || !strings.HasSuffix(err.Error(), "(test_source.json:steps[0] > test_source.json:fragments.check:steps[0])") {
+		t.Error(fmt.Errorf("the error should contain the source location, found: %v", err))
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// getGoTemplateValue renders the Go text/template and returns the result,
+// decoded as JSON value (number, boolean, object, array or null) when possible.
+func getGoTemplateValue(text string) (interface{}, error) {
+	tpl, err := template.New("value").Option("missingkey=error").Funcs(getGoTemplateFuncs()).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the template: %v", err)
+	}
+	var out bytes.Buffer
+	err = tpl.Execute(&out, getGoTemplateData())
+	if err != nil {
+		return nil, fmt.Errorf("unable to execute the template: %v", err)
+	}
+	var newval interface{}
+	if json.Unmarshal(out.Bytes(), &newval) == nil {
+		return newval, nil
+	}
+	return out.String(), nil
+}
+
+// getGoTemplateData returns the data available to the Go templates
+func getGoTemplateData() map[string]interface{} {
+	env := make(map[string]string)
+	for _, item := range os.Environ() {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) == 2 {
+			env[kv[0]] = kv[1]
+		}
+	}
+	return map[string]interface{}{
+		"vars":   testVars,
+		"params": testParams,
+		"steps":  testCache,
+		"env":    env,
+	}
+}
+
+// getGoTemplateFuncs returns the functions available to the Go templates:
+// the registered transformations and the template prefixes
+func getGoTemplateFuncs() template.FuncMap {
+	funcs := template.FuncMap{
+		"pv": func(path string) interface{} {
+			return getValidInterface(getFieldValue(path, testCache))
+		},
+		"var": func(path string) interface{} {
+			return getValidInterface(getFieldValue(path, testVars))
+		},
+		"param": func(path string) interface{} {
+			return getValidInterface(getFieldValue(path, testParams))
+		},
+		"env": func(name string) string {
+			return os.Getenv(name)
+		},
+		"ts": func(spec string) (interface{}, error) {
+			return getTimestampValue(spec)
+		},
+		"rd": func(spec string) (interface{}, error) {
+			return getRandomTemplateValue(spec)
+		},
+	}
+	for name, t := range transformers {
+		funcs[name] = getGoTemplateTransfFunc(t)
+	}
+	return funcs
+}
+
+// getGoTemplateTransfFunc converts a transformation function into a Go template function,
+// where the last argument is the value to transform (e.g. {{ .vars.id | substr 0 8 }})
+func getGoTemplateTransfFunc(t Transformer) func(...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("the value to transform is missing")
+		}
+		strargs := make([]string, len(args)-1)
+		for i, arg := range args[:len(args)-1] {
+			strargs[i] = fmt.Sprintf("%v", arg)
+		}
+		return t.Transform(args[len(args)-1], strargs)
+	}
+}
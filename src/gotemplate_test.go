@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var goTemplateCases = []struct {
+	text     string
+	expected interface{}
+}{
+	{`user-{{.vars.id}}@example.com`, "user-42@example.com"},
+	{`user-{{var "id"}}@example.com`, "user-42@example.com"},
+	{`{{(index .steps 0).Response.id}}`, "A123"},
+	{`{{pv "create.Response.id"}}-{{pv "0.Request.n"}}`, "A123-5"},
+	{`{{pv "0.Request.n"}}`, float64(5)},
+	{`{"id":"{{.vars.id}}","n":{{pv "0.Request.n"}}}`, map[string]interface{}{"id": "42", "n": float64(5)}},
+	{`{{.params.currency}}`, "GBP"},
+	{`{{param "currency" | lower}}`, "gbp"},
+	{`{{.env.NATSTEST_TPL_TEST}}-{{env "NATSTEST_TPL_TEST"}}`, "alpha-alpha"},
+	{`{{.vars.name | upper | substr 0 3}}`, "ALI"},
+	{`{{.vars.name | hmac "sha256" "key" | substr 0 8}}`, "76fb55e9"},
+	{`{{ts "+1h|2006"}}`, float64(2023)},
+	{`{{if index .vars "missing"}}yes{{else}}no{{end}}`, "no"},
+	{`[{{range $i, $s := .steps}}"{{$s.Name}}"{{end}}]`, []interface{}{"create"}},
+}
+
+func TestGetGoTemplateValue(t *testing.T) {
+	testVars = map[string]interface{}{"id": "42", "name": "alice"}
+	testParams = map[string]interface{}{"currency": "GBP"}
+	testClock = time.Unix(1700000000, 0).UTC()
+	testCache = TestEntries{{
+		Name:     "create",
+		Request:  map[string]interface{}{"n": float64(5)},
+		Response: map[string]interface{}{"id": "A123"},
+	}}
+	err := os.Setenv("NATSTEST_TPL_TEST", "alpha")
+	if err != nil {
+		t.Error(fmt.Errorf("An error was not expected: %v", err))
+	}
+	defer func() {
+		testVars = nil
+		testParams = nil
+		testCache = nil
+		testClock = time.Time{}
+		_ = os.Unsetenv("NATSTEST_TPL_TEST")
+	}()
+	for _, tt := range goTemplateCases {
+		val, err := getGoTemplateValue(tt.text)
+		if err != nil {
+			t.Error(fmt.Errorf("%s: an error was not expected: %v", tt.text, err))
+			continue
+		}
+		if !reflect.DeepEqual(val, tt.expected) {
+			t.Error(fmt.Errorf("%s: expected %#v, found %#v", tt.text, tt.expected, val))
+		}
+	}
+
+	val, ok := getTemplateValue(`~tp:{{.vars.id}}`)
+	if !ok || val != float64(42) {
+		t.Error(fmt.Errorf("Found different value than expected: %#v", val))
+	}
+}
+
+var goTemplateErrorCases = []string{
+	`{{.vars.id`,
+	`{{unknown .vars.id}}`,
+	`{{substr}}`,
+	`{{"abc" | substr 9}}`,
+	`{{ts "invalid|unix"}}`,
+	`{{.vars.missing}}`,
+}
+
+func TestGetGoTemplateValueErrors(t *testing.T) {
+	for _, text := range goTemplateErrorCases {
+		_, err := getGoTemplateValue(text)
+		if err == nil {
+			t.Error(fmt.Errorf("%s: an error was expected", text))
+		}
+	}
+}
+
+func TestReplaceGoTemplateError(t *testing.T) {
+	// the missing keys fail the replacement instead of rendering "<no value>"
+	_, err := replaceTemplates(map[string]interface{}{"id": "~tp:{{.vars.missing}}"})
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Error(fmt.Errorf("a template error was expected, found: %v", err))
+	}
+}
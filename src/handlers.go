@@ -21,16 +21,18 @@ func setBusy(val bool) {
 // return a list of available routes
 func indexHandler(rw http.ResponseWriter, hr *http.Request, ps httprouter.Params) {
 	type info struct {
-		Busy     bool     `json:"busy"`     // true if a test is in progress
-		Duration float64  `json:"duration"` // elapsed time since last test start in seconds
-		Entries  Routes   `json:"routes"`   // available routes (http entry points)
-		Tests    []string `json:"tests"`    // available test names
+		Busy     bool                `json:"busy"`     // true if a test is in progress
+		Duration float64             `json:"duration"` // elapsed time since last test start in seconds
+		Entries  Routes              `json:"routes"`   // available routes (http entry points)
+		Tests    []string            `json:"tests"`    // available test names
+		Tags     map[string][]string `json:"tags"`     // tags of the available tests
 	}
 	sendResponse(rw, hr, ps, http.StatusOK, info{
 		Busy:     busy,
 		Duration: time.Since(startTime).Seconds(),
 		Entries:  routes,
 		Tests:    testNames,
+		Tags:     getTestTags(),
 	})
 }
 
@@ -91,49 +93,63 @@ func test(rw http.ResponseWriter, hr *http.Request, ps httprouter.Params) {
 	defer setBusy(false)
 
 	startTime = time.Now()
-	testCounter := 0
-
-	var err error
-
-	test := ps.ByName("name")
-	if test == "all" {
-		// execute all tests
-		for key, testData := range testMap {
-			if key[0] != '@' { // exclude internal tests
-				testCounter++
-				err = execTest(testData)
-				if err != nil {
-					// stop as soon a one test fails
-					break
-				}
-			}
-		}
-	} else if _, exist := testMap[test]; exist {
-		// execute the selected test
-		testCounter++
-		err = execTest(testMap[test])
-	} else {
+
+	name := ps.ByName("name")
+	if _, exist := testMap[name]; !exist && name != "all" {
 		// test not found
 		sendResponse(rw, hr, ps, http.StatusNotFound, http.StatusText(http.StatusNotFound))
 		return
 	}
+
+	// the query string contains the tag expressions and the test parameters
+	query := hr.URL.Query()
+	filter, err := newTestFilter(query.Get("include"), query.Get("exclude"))
 	if err != nil {
-		sendResponse(rw, hr, ps, http.StatusExpectationFailed, err.Error())
+		sendResponse(rw, hr, ps, http.StatusBadRequest, err.Error())
 		return
 	}
+	params := make(map[string]string)
+	for key := range query {
+		if key != "include" && key != "exclude" {
+			params[key] = query.Get(key)
+		}
+	}
+
+	results, err := runTests(name, params, filter)
 
 	type info struct {
-		Tests    int     `json:"tests"`    // number of executed tests
-		Duration float64 `json:"duration"` // full test duration in seconds
-		Message  string  `json:"message"`  // message
+		Tests    int          `json:"tests"`    // number of executed tests (or data rows)
+		Duration float64      `json:"duration"` // full test duration in seconds
+		Message  string       `json:"message"`  // message
+		Results  []TestResult `json:"results"`  // result of each test (or data row)
 	}
-	sendResponse(rw, hr, ps, http.StatusOK, info{
-		Tests:    testCounter,
+	if err != nil && results == nil {
+		sendResponse(rw, hr, ps, http.StatusExpectationFailed, err.Error())
+		return
+	}
+	code := http.StatusOK
+	message := "All tests completed successfully"
+	if err != nil {
+		code = http.StatusExpectationFailed
+		message = err.Error()
+	}
+	sendResponse(rw, hr, ps, code, info{
+		Tests:    len(results),
 		Duration: time.Since(startTime).Seconds(),
-		Message:  "All tests completed successfully",
+		Message:  message,
+		Results:  results,
 	})
 }
 
+// cancel the test in progress
+func canceltest(rw http.ResponseWriter, hr *http.Request, ps httprouter.Params) {
+	if !cancelTestRun() {
+		sendResponse(rw, hr, ps, http.StatusNotFound, "no test is in progress")
+		return
+	}
+	sendResponse(rw, hr, ps, http.StatusOK, "the test run has been cancelled")
+}
+
 // reload and reset all tests from configuration files
 func reload(rw http.ResponseWriter, hr *http.Request, ps httprouter.Params) {
 	if busy {
@@ -155,7 +171,11 @@ func newtest(rw http.ResponseWriter, hr *http.Request, ps httprouter.Params) {
 		sendResponse(rw, hr, ps, http.StatusInternalServerError, err.Error())
 		return
 	}
-	err = loadRawJSONTest(body, ps.ByName("name"))
+	if isYAMLContent(hr.Header.Get("Content-Type"), body) {
+		err = loadRawYAMLTest(body, ps.ByName("name"))
+	} else {
+		err = loadRawJSONTest(body, ps.ByName("name"))
+	}
 	if err != nil {
 		sendResponse(rw, hr, ps, http.StatusExpectationFailed, err.Error())
 		return
@@ -163,6 +183,35 @@ func newtest(rw http.ResponseWriter, hr *http.Request, ps httprouter.Params) {
 	test(rw, hr, ps)
 }
 
+// validate the test sent via POST without loading or executing it
+func validatetest(rw http.ResponseWriter, hr *http.Request, ps httprouter.Params) {
+	body, err := ioutil.ReadAll(hr.Body)
+	if err != nil {
+		sendResponse(rw, hr, ps, http.StatusInternalServerError, err.Error())
+		return
+	}
+	source := "test_" + ps.ByName("name") + ".json"
+	if isYAMLContent(hr.Header.Get("Content-Type"), body) {
+		source = "test_" + ps.ByName("name") + ".yaml"
+	}
+	// the included fragments are read from the fragment files, without using the loaded ones
+	_, fragments, err := validateFragmentFiles()
+	if err != nil {
+		sendResponse(rw, hr, ps, http.StatusInternalServerError, err.Error())
+		return
+	}
+	problems := validateRawTest(body, source, fragments)
+	type info struct {
+		Valid    bool                `json:"valid"`    // true if no problems were found
+		Problems []ValidationProblem `json:"problems"` // list of problems
+	}
+	if len(problems) > 0 {
+		sendResponse(rw, hr, ps, http.StatusExpectationFailed, info{Valid: false, Problems: problems})
+		return
+	}
+	sendResponse(rw, hr, ps, http.StatusOK, info{Valid: true, Problems: []ValidationProblem{}})
+}
+
 // remove the specified test
 func deltest(rw http.ResponseWriter, hr *http.Request, ps httprouter.Params) {
 	if busy {
@@ -170,13 +219,9 @@ func deltest(rw http.ResponseWriter, hr *http.Request, ps httprouter.Params) {
 		return
 	}
 	name := ps.ByName("name")
-	for item, value := range testNames {
-		if value == name {
-			testNames = append(testNames[:item], testNames[item+1:]...)
-			delete(testMap, name)
-			sendResponse(rw, hr, ps, http.StatusOK, fmt.Sprintf("the test %s has been successfully removed", name))
-			return
-		}
+	if deleteTest(name) {
+		sendResponse(rw, hr, ps, http.StatusOK, fmt.Sprintf("the test %s has been successfully removed", name))
+		return
 	}
 	sendResponse(rw, hr, ps, http.StatusNotFound, fmt.Sprintf("unable to find the test %s", name))
 }
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// JWTKey contains the configuration of a key used to sign and verify JSON Web Tokens
+type JWTKey struct {
+	Alg            string `mapstructure:"alg" json:"alg"`                       // signing algorithm (e.g. HS256, RS256, ES256)
+	Secret         string `mapstructure:"secret" json:"secret"`                 // shared secret for the HMAC algorithms
+	PrivateKeyFile string `mapstructure:"privateKeyFile" json:"privateKeyFile"` // PEM file containing the private key used to sign the tokens
+	PublicKeyFile  string `mapstructure:"publicKeyFile" json:"publicKeyFile"`   // PEM file containing the public key or certificate used to verify the tokens
+	JWKSFile       string `mapstructure:"jwksFile" json:"jwksFile"`             // JSON Web Key Set file containing the public keys used to verify the tokens
+}
+
+// jwtKeys contains the configured JWT keys indexed by lowercase name
+var jwtKeys = make(map[string]JWTKey)
+
+// jsonWebKey contains the fields of a JSON Web Key used to verify the tokens
+type jsonWebKey struct {
+	Kty string `json:"kty"` // key type: RSA, EC or oct
+	Kid string `json:"kid"` // key ID
+	Alg string `json:"alg"` // algorithm
+	N   string `json:"n"`   // RSA modulus
+	E   string `json:"e"`   // RSA public exponent
+	Crv string `json:"crv"` // EC curve
+	X   string `json:"x"`   // EC x coordinate
+	Y   string `json:"y"`   // EC y coordinate
+	K   string `json:"k"`   // symmetric key
+}
+
+// getJWTKey returns the configured JWT key with the specified name
+func getJWTKey(name string) (JWTKey, error) {
+	key, ok := jwtKeys[strings.ToLower(name)]
+	if !ok {
+		return key, fmt.Errorf("unable to find the JWT key: %s", name)
+	}
+	if !isValidJWTAlg(key.Alg) {
+		return key, fmt.Errorf("invalid JWT algorithm for the key %s: %s", name, key.Alg)
+	}
+	if isHMACJWTAlg(key.Alg) && key.Secret == "" && key.JWKSFile == "" {
+		return key, fmt.Errorf("the JWT key %s requires a secret for the %s algorithm", name, key.Alg)
+	}
+	return key, nil
+}
+
+// isValidJWTAlg returns true if the algorithm is supported (unsigned tokens are not allowed)
+func isValidJWTAlg(alg string) bool {
+	return alg != "none" && jwt.GetSigningMethod(alg) != nil
+}
+
+// isHMACJWTAlg returns true if the algorithm uses a shared secret
+func isHMACJWTAlg(alg string) bool {
+	_, ok := jwt.GetSigningMethod(alg).(*jwt.SigningMethodHMAC)
+	return ok
+}
+
+// signJWT returns a JSON Web Token containing the claims, signed with the configured key
+func signJWT(name string, claims interface{}) (string, error) {
+	key, err := getJWTKey(name)
+	if err != nil {
+		return "", err
+	}
+	if str, ok := claims.(string); ok {
+		// JSON-encoded claims
+		err = json.Unmarshal([]byte(str), &claims)
+		if err != nil {
+			return "", fmt.Errorf("unable to decode the JWT claims: %v", err)
+		}
+	}
+	mapClaims, ok := claims.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("the JWT claims must be an object: %#v", claims)
+	}
+	method := jwt.GetSigningMethod(key.Alg)
+	var signKey interface{}
+	switch method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if key.Secret == "" {
+			return "", fmt.Errorf("the secret is required to sign %s tokens", key.Alg)
+		}
+		signKey = []byte(key.Secret)
+	default:
+		signKey, err = getJWTPrivateKey(key, method)
+		if err != nil {
+			return "", err
+		}
+	}
+	return jwt.NewWithClaims(method, jwt.MapClaims(mapClaims)).SignedString(signKey)
+}
+
+// getJWTPrivateKey returns the private key used to sign the tokens
+func getJWTPrivateKey(key JWTKey, method jwt.SigningMethod) (interface{}, error) {
+	if key.PrivateKeyFile == "" {
+		return nil, fmt.Errorf("the privateKeyFile is required to sign %s tokens", key.Alg)
+	}
+	pem, err := readJWTKeyFile(key.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	switch method.(type) {
+	case *jwt.SigningMethodECDSA:
+		return jwt.ParseECPrivateKeyFromPEM(pem)
+	case *jwt.SigningMethodEd25519:
+		return jwt.ParseEdPrivateKeyFromPEM(pem)
+	}
+	return jwt.ParseRSAPrivateKeyFromPEM(pem)
+}
+
+// verifyJWT verifies the signature and the time claims of the token and returns the decoded claims
+func verifyJWT(name string, token string) (map[string]interface{}, error) {
+	key, err := getJWTKey(name)
+	if err != nil {
+		return nil, err
+	}
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return getJWTVerifyKey(key, t)
+	}, jwt.WithValidMethods([]string{key.Alg}))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT: %v", err)
+	}
+	return claims, nil
+}
+
+// getJWTVerifyKey returns the key used to verify the token signature
+func getJWTVerifyKey(key JWTKey, token *jwt.Token) (interface{}, error) {
+	if key.JWKSFile != "" {
+		kid, _ := token.Header["kid"].(string)
+		return getJWKSKey(key.JWKSFile, kid, key.Alg)
+	}
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if key.Secret == "" {
+			return nil, fmt.Errorf("the secret or jwksFile is required to verify %s tokens", key.Alg)
+		}
+		return []byte(key.Secret), nil
+	}
+	if key.PublicKeyFile == "" {
+		return nil, fmt.Errorf("the publicKeyFile or jwksFile is required to verify %s tokens", key.Alg)
+	}
+	pem, err := readJWTKeyFile(key.PublicKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	switch token.Method.(type) {
+	case *jwt.SigningMethodECDSA:
+		return jwt.ParseECPublicKeyFromPEM(pem)
+	case *jwt.SigningMethodEd25519:
+		return jwt.ParseEdPublicKeyFromPEM(pem)
+	}
+	return jwt.ParseRSAPublicKeyFromPEM(pem)
+}
+
+// readJWTKeyFile reads a key file, searching the relative paths in the configuration directories
+func readJWTKeyFile(file string) ([]byte, error) {
+	path, err := findConfigFile(file)
+	if err != nil {
+		return nil, err
+	}
+	/* #nosec */
+	return ioutil.ReadFile(path)
+}
+
+// getJWKSKey returns the public key with the specified ID (or the first key compatible with the algorithm) from the JWKS file
+func getJWKSKey(file string, kid string, alg string) (interface{}, error) {
+	raw, err := readJWTKeyFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = json.Unmarshal(raw, &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode the JWKS file %s: %v", file, err)
+	}
+	for _, jwk := range jwks.Keys {
+		if (kid != "" && jwk.Kid != kid) || (jwk.Alg != "" && jwk.Alg != alg) || !jwk.isAlgCompatible(alg) {
+			continue
+		}
+		return jwk.getPublicKey()
+	}
+	return nil, fmt.Errorf("unable to find the key %q in the JWKS file %s", kid, file)
+}
+
+// isAlgCompatible returns true if the key type can be used with the algorithm
+func (jwk jsonWebKey) isAlgCompatible(alg string) bool {
+	switch alg[:2] {
+	case "HS":
+		return jwk.Kty == "oct"
+	case "RS", "PS":
+		return jwk.Kty == "RSA"
+	case "ES":
+		return jwk.Kty == "EC"
+	}
+	return false
+}
+
+// getPublicKey returns the public key (or the secret for symmetric keys) of the JSON Web Key
+func (jwk jsonWebKey) getPublicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeJWKNumber(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKNumber(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[jwk.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported JWK curve: %s", jwk.Crv)
+		}
+		x, err := decodeJWKNumber(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKNumber(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(jwk.K)
+		if err != nil || len(secret) == 0 {
+			return nil, fmt.Errorf("invalid JWK symmetric key: %s", jwk.Kid)
+		}
+		return secret, nil
+	}
+	return nil, fmt.Errorf("unsupported JWK key type: %s", jwk.Kty)
+}
+
+// decodeJWKNumber decodes a base64url-encoded big-endian number
+func decodeJWKNumber(value string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(raw) == 0 {
+		return nil, fmt.Errorf("invalid JWK number: %s", value)
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
+
+// getJWTTemplateValue returns a signed token from a template in the form "KEYNAME:CLAIMS",
+// where CLAIMS is a JSON object that can contain other templates
+func getJWTTemplateValue(spec string) (interface{}, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("the JWT template requires the key name and the claims: %s", spec)
+	}
+	var claims interface{}
+	err := json.Unmarshal([]byte(parts[1]), &claims)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode the JWT claims: %v", err)
+	}
+	claims, err = replaceTemplates(claims)
+	if err != nil {
+		return nil, err
+	}
+	token, err := signJWT(parts[0], claims)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// processCompareJWT verifies the actual token with the key specified by the matcher in the form "~jv:KEYNAME[:CLAIMS]",
+// and checks that the decoded claims match the optional expected claims template
+func processCompareJWT(arg string, actual interface{}) error {
+	value := "~jv:" + arg
+	parts := strings.SplitN(arg, ":", 2)
+	token, ok := actual.(string)
+	if !ok {
+		return getFormattedDiffError("the value is not a JWT", value, actual)
+	}
+	claims, err := verifyJWT(parts[0], token)
+	if err != nil {
+		return getFormattedDiffError(err.Error(), value, token)
+	}
+	if len(parts) == 1 {
+		return nil
+	}
+	var expected interface{}
+	err = json.Unmarshal([]byte(parts[1]), &expected)
+	if err != nil {
+		return fmt.Errorf("unable to decode the expected JWT claims: %v", err)
+	}
+	expected, err = replaceTemplates(expected)
+	if err != nil {
+		return err
+	}
+	err = areMatching(expected, claims)
+	if err != nil {
+		return fmt.Errorf("the JWT claims are different: %v", err)
+	}
+	return nil
+}
+
+// transfJWTSign signs the claims with the specified key (e.g. "jwtsign:authKey")
+func transfJWTSign(value interface{}, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("the jwtsign transformation requires the key name")
+	}
+	return signJWT(args[0], value)
+}
+
+// transfJWTDecode returns the claims of a token without verifying the signature
+func transfJWTDecode(value interface{}, args []string) (interface{}, error) {
+	token, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("the value is not a JWT: %#v", value)
+	}
+	claims := jwt.MapClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(token, claims)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT: %v", err)
+	}
+	return map[string]interface{}(claims), nil
+}
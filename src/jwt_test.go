@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// setTestJWTKeys creates the test key files and configures the JWT keys
+func setTestJWTKeys(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "natstest-jwt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDer, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPubDer, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa1", "n": "AQAB", "e": "AQAB"},
+			{
+				"kty": "EC",
+				"kid": "ec1",
+				"alg": "ES256",
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(ecKey.X.Bytes()),
+				"y":   base64.RawURLEncoding.EncodeToString(ecKey.Y.Bytes()),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"rsa.key":   pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+		"rsa.pub":   pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaPubDer}),
+		"ec.key":    pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDer}),
+		"jwks.json": jwks,
+	}
+	for name, data := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, name), data, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldKeys := jwtKeys
+	jwtKeys = map[string]JWTKey{
+		"hs":      {Alg: "HS256", Secret: "secret"},
+		"rs":      {Alg: "RS256", PrivateKeyFile: filepath.Join(dir, "rsa.key"), PublicKeyFile: filepath.Join(dir, "rsa.pub")},
+		"es":      {Alg: "ES256", PrivateKeyFile: filepath.Join(dir, "ec.key"), JWKSFile: filepath.Join(dir, "jwks.json")},
+		"other":   {Alg: "HS256", Secret: "other"},
+		"nofile":  {Alg: "RS256"},
+		"invalid": {Alg: "XX256", Secret: "secret"},
+	}
+	return func() {
+		jwtKeys = oldKeys
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestSignVerifyJWT(t *testing.T) {
+	defer setTestJWTKeys(t)()
+	claims := map[string]interface{}{"sub": "alice", "exp": float64(time.Now().Add(time.Hour).Unix())}
+	for _, name := range []string{"hs", "HS", "rs", "es"} {
+		token, err := signJWT(name, claims)
+		if err != nil {
+			t.Error(fmt.Errorf("%s: an error was not expected: %v", name, err))
+			continue
+		}
+		decoded, err := verifyJWT(name, token)
+		if err != nil {
+			t.Error(fmt.Errorf("%s: an error was not expected: %v", name, err))
+			continue
+		}
+		if decoded["sub"] != "alice" {
+			t.Error(fmt.Errorf("%s: found different claims than expected: %#v", name, decoded))
+		}
+	}
+}
+
+func TestSignVerifyJWTErrors(t *testing.T) {
+	defer setTestJWTKeys(t)()
+	if _, err := signJWT("missing", map[string]interface{}{}); err == nil {
+		t.Error(fmt.Errorf("an error was expected (missing key)"))
+	}
+	if _, err := signJWT("invalid", map[string]interface{}{}); err == nil {
+		t.Error(fmt.Errorf("an error was expected (invalid algorithm)"))
+	}
+	if _, err := signJWT("nofile", map[string]interface{}{}); err == nil {
+		t.Error(fmt.Errorf("an error was expected (missing private key)"))
+	}
+	if _, err := signJWT("hs", []interface{}{1}); err == nil {
+		t.Error(fmt.Errorf("an error was expected (invalid claims)"))
+	}
+	if _, err := signJWT("hs", "{"); err == nil {
+		t.Error(fmt.Errorf("an error was expected (invalid JSON claims)"))
+	}
+	token, _ := signJWT("hs", `{"sub":"alice"}`)
+	if _, err := verifyJWT("other", token); err == nil {
+		t.Error(fmt.Errorf("an error was expected (wrong secret)"))
+	}
+	if _, err := verifyJWT("rs", token); err == nil {
+		t.Error(fmt.Errorf("an error was expected (wrong algorithm)"))
+	}
+	expired, _ := signJWT("hs", map[string]interface{}{"exp": float64(time.Now().Add(-time.Hour).Unix())})
+	if _, err := verifyJWT("hs", expired); err == nil {
+		t.Error(fmt.Errorf("an error was expected (expired token)"))
+	}
+	jwtKeys["nofile"] = JWTKey{Alg: "HS256", JWKSFile: "/missing/jwks.json"}
+	if _, err := verifyJWT("nofile", token); err == nil {
+		t.Error(fmt.Errorf("an error was expected (missing JWKS file)"))
+	}
+}
+
+func TestJWTEmptySecret(t *testing.T) {
+	defer setTestJWTKeys(t)()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "alice"}).SignedString([]byte(""))
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	jwtKeys["empty"] = JWTKey{Alg: "HS256", PrivateKeyFile: "hs.key"}
+	if _, err = signJWT("empty", map[string]interface{}{"sub": "alice"}); err == nil {
+		t.Error(fmt.Errorf("an error was expected (empty secret)"))
+	}
+	if _, err = verifyJWT("empty", token); err == nil {
+		t.Error(fmt.Errorf("the token signed with an empty secret was not expected to be valid"))
+	}
+	if _, err = getJWTVerifyKey(JWTKey{Alg: "HS256"}, &jwt.Token{Method: jwt.SigningMethodHS256}); err == nil {
+		t.Error(fmt.Errorf("an error was expected (empty verification secret)"))
+	}
+	if _, err = (jsonWebKey{Kty: "oct", K: ""}).getPublicKey(); err == nil {
+		t.Error(fmt.Errorf("an error was expected (empty JWK secret)"))
+	}
+}
+
+func TestJWTTemplates(t *testing.T) {
+	defer setTestJWTKeys(t)()
+	testVars = map[string]interface{}{"user": "alice"}
+	defer func() { testVars = nil }()
+
+	val, ok := getTemplateValue(`~jw:rs:{"sub":"~var:user","exp":"~ts:+1h|unix"}`)
+	token, isStr := val.(string)
+	if !ok || !isStr || strings.Count(token, ".") != 2 {
+		t.Error(fmt.Errorf("a JWT was expected, found: %#v", val))
+		return
+	}
+
+	var matcherCases = []struct {
+		expected string
+		match    bool
+	}{
+		{"~jv:rs", true},
+		{`~jv:rs:{"sub":"alice","exp":"~tm:within(1m,+1h)"}`, true},
+		{`~jv:rs:{"sub":"~var:user"}`, true},
+		{`~jv:rs:{"sub":"bob"}`, false},
+		{`~jv:rs:{"role":"~present"}`, false},
+		{"~jv:hs", false},
+		{"~jv:missing", false},
+		{"~not:~jv:hs", true},
+	}
+	for _, tt := range matcherCases {
+		err := areMatching(map[string]interface{}{"token": tt.expected}, map[string]interface{}{"token": token})
+		if tt.match && err != nil {
+			t.Error(fmt.Errorf("%s: an error was not expected: %v", tt.expected, err))
+		}
+		if !tt.match && err == nil {
+			t.Error(fmt.Errorf("%s: an error was expected", tt.expected))
+		}
+	}
+
+	decoded, err := execTransfChain("jwtdecode>jsonpath:sub", reflect.ValueOf(token))
+	if err != nil || decoded.Interface() != "alice" {
+		t.Error(fmt.Errorf("found different value than expected: %v %v", decoded, err))
+	}
+	signed, err := execTransfChain("jwtsign:hs", reflect.ValueOf(map[string]interface{}{"sub": "bob"}))
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	claims, err := verifyJWT("hs", signed.Interface().(string))
+	if err != nil || claims["sub"] != "bob" {
+		t.Error(fmt.Errorf("found different value than expected: %v %v", claims, err))
+	}
+
+	for _, spec := range []string{"~jw:hs", `~jw:hs:{`, `~jw:missing:{"sub":"x"}`} {
+		if val, _ := getTemplateValue(spec); val != nil {
+			t.Error(fmt.Errorf("%s: a nil value was expected, found: %#v", spec, val))
+		}
+	}
+}
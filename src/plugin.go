@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Matcher is the interface implemented by the named matchers used in the expected response templates ("~NAME:ARG").
+// The Match method receives the matcher argument and the actual value, and returns an error if the value does not match.
+type Matcher interface {
+	Match(arg string, actual interface{}) error
+}
+
+// MatcherFunc is an adapter to use an ordinary function as Matcher
+type MatcherFunc func(arg string, actual interface{}) error
+
+// Match calls f(arg, actual)
+func (f MatcherFunc) Match(arg string, actual interface{}) error {
+	return f(arg, actual)
+}
+
+// Transformer is the interface implemented by the named transformations used in the template chains (">NAME:ARG1:ARG2").
+// The Transform method receives the value and the arguments, and returns the transformed value.
+type Transformer interface {
+	Transform(value interface{}, args []string) (interface{}, error)
+}
+
+// TransformerFunc is an adapter to use an ordinary function as Transformer
+type TransformerFunc func(value interface{}, args []string) (interface{}, error)
+
+// Transform calls f(value, args)
+func (f TransformerFunc) Transform(value interface{}, args []string) (interface{}, error) {
+	return f(value, args)
+}
+
+// TemplateProvider is the interface implemented by the named template prefixes ("~NAME:ARG").
+// The Value method receives the template argument and returns the value that replaces the template.
+type TemplateProvider interface {
+	Value(arg string) (interface{}, error)
+}
+
+// TemplateFunc is an adapter to use an ordinary function as TemplateProvider
+type TemplateFunc func(arg string) (interface{}, error)
+
+// Value calls f(arg)
+func (f TemplateFunc) Value(arg string) (interface{}, error) {
+	return f(arg)
+}
+
+// matchers is the registry of the named matchers
+var matchers = make(map[string]Matcher)
+
+// transformers is the registry of the named transformations
+var transformers = make(map[string]Transformer)
+
+// templateProviders is the registry of the named template prefixes
+var templateProviders = make(map[string]TemplateProvider)
+
+// pluginName matches the valid names of matchers and transformations
+var pluginName = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// reservedNames contains the markers and the fragment argument prefix, which can't be used as matcher or template names
+var reservedNames = map[string]bool{
+	"arg": true, "not": true, "absent": true, "present": true, "null": true, "strict": true, "unordered": true, "contains": true,
+}
+
+// reservedTransformerNames contains the built-in functions of the Go templates that can't be replaced by a transformation
+var reservedTransformerNames = map[string]bool{
+	"pv": true, "var": true, "param": true, "env": true, "ts": true, "rd": true,
+	"and": true, "or": true, "not": true, "call": true, "html": true, "index": true, "slice": true, "js": true, "len": true,
+	"print": true, "printf": true, "println": true, "urlquery": true, "eq": true, "ne": true, "lt": true, "le": true, "gt": true, "ge": true,
+}
+
+// RegisterMatcher adds a named matcher to the registry, so it can be used in the expected response templates as "~NAME:ARG"
+func RegisterMatcher(name string, m Matcher) error {
+	if !pluginName.MatchString(name) || reservedNames[name] {
+		return fmt.Errorf("invalid matcher name: %s", name)
+	}
+	if _, exist := matchers[name]; exist {
+		return fmt.Errorf("the matcher %s is already registered", name)
+	}
+	if _, exist := templateProviders[name]; exist {
+		return fmt.Errorf("the matcher name %s is already used by a template prefix", name)
+	}
+	matchers[name] = m
+	return nil
+}
+
+// RegisterTransformer adds a named transformation to the registry, so it can be used in the template chains as ">NAME:ARGS"
+func RegisterTransformer(name string, t Transformer) error {
+	if !pluginName.MatchString(name) || reservedTransformerNames[name] {
+		return fmt.Errorf("invalid transformer name: %s", name)
+	}
+	if _, exist := transformers[name]; exist {
+		return fmt.Errorf("the transformer %s is already registered", name)
+	}
+	transformers[name] = t
+	return nil
+}
+
+// RegisterTemplate adds a named template prefix to the registry, so it can be used in the requests and responses as "~NAME:ARG"
+func RegisterTemplate(name string, p TemplateProvider) error {
+	if !pluginName.MatchString(name) || reservedNames[name] {
+		return fmt.Errorf("invalid template name: %s", name)
+	}
+	if _, exist := templateProviders[name]; exist {
+		return fmt.Errorf("the template %s is already registered", name)
+	}
+	if _, exist := matchers[name]; exist {
+		return fmt.Errorf("the template name %s is already used by a matcher", name)
+	}
+	templateProviders[name] = p
+	return nil
+}
+
+// mustRegisterMatcher registers a built-in matcher and panics in case of error
+func mustRegisterMatcher(name string, m MatcherFunc) {
+	if err := RegisterMatcher(name, m); err != nil {
+		panic(err)
+	}
+}
+
+// mustRegisterTransformer registers a built-in transformation and panics in case of error
+func mustRegisterTransformer(name string, t TransformerFunc) {
+	if err := RegisterTransformer(name, t); err != nil {
+		panic(err)
+	}
+}
+
+// mustRegisterTemplate registers a built-in template prefix and panics in case of error
+func mustRegisterTemplate(name string, p TemplateFunc) {
+	if err := RegisterTemplate(name, p); err != nil {
+		panic(err)
+	}
+}
+
+// getTemplateProvider returns the registered template prefix and its argument from a value in the form "~NAME:ARG"
+func getTemplateProvider(value string) (TemplateProvider, string, bool) {
+	if !strings.HasPrefix(value, "~") {
+		return nil, "", false
+	}
+	parts := strings.SplitN(value[1:], ":", 2)
+	if len(parts) != 2 {
+		return nil, "", false
+	}
+	p, ok := templateProviders[parts[0]]
+	return p, parts[1], ok
+}
+
+// getMatcher returns the registered matcher and its argument from an expected value in the form "~NAME:ARG",
+// where the argument is required (the values without argument are compared as simple strings)
+func getMatcher(value string) (Matcher, string, bool) {
+	if !strings.HasPrefix(value, "~") {
+		return nil, "", false
+	}
+	parts := strings.SplitN(value[1:], ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, "", false
+	}
+	m, ok := matchers[parts[0]]
+	return m, parts[1], ok
+}
+
+// getTransformer returns the registered transformation and its arguments, or false if the transformation is not registered
+func getTransformer(transf string) (Transformer, []string, bool) {
+	parts := strings.Split(strings.TrimSpace(transf), ":")
+	t, ok := transformers[parts[0]]
+	return t, parts[1:], ok
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRegisterMatcher(t *testing.T) {
+	err := RegisterMatcher("prefix", MatcherFunc(func(arg string, actual interface{}) error {
+		if str, ok := actual.(string); ok && strings.HasPrefix(str, arg) {
+			return nil
+		}
+		return getFormattedDiffError("the value has a different prefix", "~prefix:"+arg, actual)
+	}))
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+	defer delete(matchers, "prefix")
+
+	err = areMatching(map[string]interface{}{"id": "~prefix:usr_"}, map[string]interface{}{"id": "usr_123"})
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+	err = areMatching(map[string]interface{}{"id": "~prefix:usr_"}, map[string]interface{}{"id": "grp_123"})
+	if err == nil {
+		t.Error(fmt.Errorf("an error was expected"))
+	}
+	err = areMatching("~not:~prefix:usr_", "grp_123")
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+
+	for _, name := range []string{"prefix", "re", "not", "pv", "", "1abc", "a-b"} {
+		err = RegisterMatcher(name, MatcherFunc(func(arg string, actual interface{}) error { return nil }))
+		if err == nil {
+			t.Error(fmt.Errorf("%q: an error was expected", name))
+		}
+	}
+}
+
+func TestRegisterTransformer(t *testing.T) {
+	err := RegisterTransformer("repeat", TransformerFunc(func(value interface{}, args []string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("the repeat transformation requires the count")
+		}
+		num, err := getTransfNumber(args[0])
+		if err != nil {
+			return nil, err
+		}
+		str, err := getTransfString(value)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Repeat(str, int(num)), nil
+	}))
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+	defer delete(transformers, "repeat")
+
+	val, err := execTransfChain("repeat:3>upper", reflect.ValueOf("ab"))
+	if err != nil || val.Interface() != "ABABAB" {
+		t.Error(fmt.Errorf("found different value than expected: %v %v", val, err))
+	}
+	_, err = execTransfChain("repeat", reflect.ValueOf("ab"))
+	if err == nil {
+		t.Error(fmt.Errorf("an error was expected"))
+	}
+	out, err := getGoTemplateValue(`{{ "xy" | repeat "2" }}`)
+	if err != nil || out != "xyxy" {
+		t.Error(fmt.Errorf("found different value than expected: %v %v", out, err))
+	}
+
+	for _, name := range []string{"repeat", "base64enc", "", "a:b", "pv", "var", "param", "env", "ts", "rd", "printf"} {
+		err = RegisterTransformer(name, TransformerFunc(func(value interface{}, args []string) (interface{}, error) { return value, nil }))
+		if err == nil {
+			t.Error(fmt.Errorf("%q: an error was expected", name))
+		}
+	}
+}
+
+func TestRegisterTemplate(t *testing.T) {
+	err := RegisterTemplate("rev", TemplateFunc(func(arg string) (interface{}, error) {
+		if arg == "" {
+			return nil, fmt.Errorf("the value to reverse is missing")
+		}
+		runes := []rune(arg)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return string(runes), nil
+	}))
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+	defer delete(templateProviders, "rev")
+
+	val, err := replaceTemplates(map[string]interface{}{"id": "~rev:abc", "other": "~unknown:abc"})
+	expected := map[string]interface{}{"id": "cba", "other": "~unknown:abc"}
+	if err != nil || !reflect.DeepEqual(val, expected) {
+		t.Error(fmt.Errorf("found different value than expected: %#v %v", val, err))
+	}
+	_, err = replaceTemplates(map[string]interface{}{"empty": "~rev:"})
+	if err == nil || !strings.Contains(err.Error(), "the value to reverse is missing") {
+		t.Error(fmt.Errorf("the template error was expected, found: %v", err))
+	}
+	err = areMatching(map[string]interface{}{"id": "~rev:abc"}, map[string]interface{}{"id": "cba"})
+	if err == nil {
+		t.Error(fmt.Errorf("the templates were expected to be replaced before the comparison"))
+	}
+
+	for _, name := range []string{"rev", "pv", "var", "re", "not", "", "a:b"} {
+		err = RegisterTemplate(name, TemplateFunc(func(arg string) (interface{}, error) { return arg, nil }))
+		if err == nil {
+			t.Error(fmt.Errorf("%q: an error was expected", name))
+		}
+	}
+	if err = RegisterMatcher("rev", MatcherFunc(func(arg string, actual interface{}) error { return nil })); err == nil {
+		t.Error(fmt.Errorf("the matcher name was expected to conflict with the template prefix"))
+	}
+}
+
+func TestGetTemplateProvider(t *testing.T) {
+	_, arg, ok := getTemplateProvider("~pv:0.Response.id>upper")
+	if !ok || arg != "0.Response.id>upper" {
+		t.Error(fmt.Errorf("found different value than expected: %q %v", arg, ok))
+	}
+	for _, value := range []string{"pv:0", "~pv", "~unknown:abc", "~re:abc"} {
+		if _, _, ok = getTemplateProvider(value); ok {
+			t.Error(fmt.Errorf("%q: the template was not expected", value))
+		}
+	}
+}
+
+func TestGetMatcher(t *testing.T) {
+	_, arg, ok := getMatcher("~re:^[a-z]+:[0-9]+$")
+	if !ok || arg != "^[a-z]+:[0-9]+$" {
+		t.Error(fmt.Errorf("found different value than expected: %q %v", arg, ok))
+	}
+	for _, value := range []string{"re:abc", "~unknown:abc", "~", "~re", "~re:", "~tm"} {
+		if _, _, ok = getMatcher(value); ok {
+			t.Error(fmt.Errorf("%q: the matcher was not expected", value))
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// randomVar is the name of the test variable containing the list of all the generated random values
+const randomVar = "random"
+
+// randomAlphabet is the default alphabet used to generate random strings
+const randomAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// randomEmailDomain is the default domain of the random email addresses
+const randomEmailDomain = "example.com"
+
+// randomVarName matches the optional variable name at the end of a random template (e.g. "=orderRef")
+var randomVarName = regexp.MustCompile(`=([a-zA-Z_][a-zA-Z0-9_]*)$`)
+
+// getRandomTemplateValue generates a random value as specified by the template
+// (e.g. "uuid4", "int:1:100=quantity") and records it in the test variables
+func getRandomTemplateValue(spec string) (interface{}, error) {
+	name := ""
+	if match := randomVarName.FindStringSubmatch(spec); match != nil {
+		name = match[1]
+		spec = spec[:len(spec)-len(match[0])]
+	}
+	value, err := getRandomValue(spec)
+	if err != nil {
+		return nil, err
+	}
+	if testVars != nil {
+		list, _ := testVars[randomVar].([]interface{})
+		testVars[randomVar] = append(list, value)
+		if name != "" {
+			testVars[name] = value
+		}
+	}
+	return value, nil
+}
+
+// randomSpec is a parsed random generator specification
+type randomSpec struct {
+	generator string // uuid4, uuid7, int, str or email
+	min       int64  // minimum value of the random integers
+	max       int64  // maximum value of the random integers
+	length    int    // length of the random strings
+	alphabet  string // characters of the random strings
+	domain    string // domain of the random email addresses
+}
+
+// getRandomValue generates a random value using the generator specification
+// (uuid4, uuid7, int:<min>:<max>, str:<length>[:<alphabet>] or email[:<domain>])
+func getRandomValue(spec string) (interface{}, error) {
+	rs, err := parseRandomSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	return rs.generate()
+}
+
+// parseRandomSpec parses the generator specification without generating the value
+func parseRandomSpec(spec string) (randomSpec, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	rs := randomSpec{generator: parts[0]}
+	var err error
+	switch parts[0] {
+	case "uuid4", "uuid7":
+		return rs, nil
+	case "int":
+		if len(parts) < 2 {
+			return rs, fmt.Errorf("missing range for the random integer: %s", spec)
+		}
+		rs.min, rs.max, err = parseRandomRange(parts[1])
+		return rs, err
+	case "str":
+		if len(parts) < 2 {
+			return rs, fmt.Errorf("missing length for the random string: %s", spec)
+		}
+		rs.length, rs.alphabet, err = parseRandomStringSpec(parts[1])
+		return rs, err
+	case "email":
+		rs.domain = randomEmailDomain
+		if len(parts) == 2 && parts[1] != "" {
+			rs.domain = parts[1]
+		}
+		return rs, nil
+	}
+	return rs, fmt.Errorf("unknown random generator: %s", spec)
+}
+
+// generate returns a new random value of the parsed specification
+func (rs randomSpec) generate() (interface{}, error) {
+	switch rs.generator {
+	case "uuid4":
+		return uuid.New().String(), nil
+	case "uuid7":
+		id, err := uuid.NewV7()
+		if err != nil {
+			return nil, err
+		}
+		return id.String(), nil
+	case "int":
+		num, err := rand.Int(rand.Reader, new(big.Int).Add(new(big.Int).Sub(big.NewInt(rs.max), big.NewInt(rs.min)), big.NewInt(1)))
+		if err != nil {
+			return nil, err
+		}
+		return rs.min + num.Int64(), nil
+	case "str":
+		return getRandomString(rs.length, rs.alphabet)
+	}
+	local, err := getRandomString(10, "abcdefghijklmnopqrstuvwxyz0123456789")
+	if err != nil {
+		return nil, err
+	}
+	return local + "@" + rs.domain, nil
+}
+
+// parseRandomRange parses the range of the random integers ("<min>:<max>", both inclusive)
+func parseRandomRange(spec string) (int64, int64, error) {
+	bounds := strings.SplitN(spec, ":", 2)
+	if len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("invalid range for the random integer: %s", spec)
+	}
+	min, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid minimum value for the random integer: %s", spec)
+	}
+	max, err := strconv.ParseInt(bounds[1], 10, 64)
+	if err != nil || max < min {
+		return 0, 0, fmt.Errorf("invalid maximum value for the random integer: %s", spec)
+	}
+	return min, max, nil
+}
+
+// parseRandomStringSpec parses the length and the alphabet of the random strings ("<length>[:<alphabet>]")
+func parseRandomStringSpec(spec string) (int, string, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	length, err := strconv.Atoi(parts[0])
+	if err != nil || length < 0 {
+		return 0, "", fmt.Errorf("invalid length for the random string: %s", spec)
+	}
+	if length > RandomMaxLength {
+		return 0, "", fmt.Errorf("the length of the random string exceeds the maximum of %d: %s", RandomMaxLength, spec)
+	}
+	alphabet := randomAlphabet
+	if len(parts) == 2 && parts[1] != "" {
+		alphabet = parts[1]
+	}
+	return length, alphabet, nil
+}
+
+// getRandomString returns a random string of the specified length using the characters of the alphabet
+func getRandomString(length int, alphabet string) (string, error) {
+	chars := []rune(alphabet)
+	out := make([]rune, length)
+	for i := range out {
+		idx, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return "", err
+		}
+		out[i] = chars[idx.Int64()]
+	}
+	return string(out), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+func TestGetRandomValue(t *testing.T) {
+	var testCases = []struct {
+		spec  string
+		regex string
+	}{
+		{"uuid4", "^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$"},
+		{"uuid7", "^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$"},
+		{"int:5:7", "^[5-7]$"},
+		{"int:-3:-3", "^-3$"},
+		{"str:12", "^[a-zA-Z0-9]{12}$"},
+		{"str:8:xyz:", "^[xyz:]{8}$"},
+		{"str:0", "^$"},
+		{"email", "^[a-z0-9]{10}@example\\.com$"},
+		{"email:test.org", "^[a-z0-9]{10}@test\\.org$"},
+	}
+	for _, tt := range testCases {
+		val, err := getRandomValue(tt.spec)
+		if err != nil {
+			t.Error(fmt.Errorf("an error was not expected for %s: %v", tt.spec, err))
+			continue
+		}
+		if match, _ := regexp.MatchString(tt.regex, fmt.Sprintf("%v", val)); !match {
+			t.Error(fmt.Errorf("the value %v for %s does not match %s", val, tt.spec, tt.regex))
+		}
+	}
+}
+
+func TestGetRandomValueErrors(t *testing.T) {
+	var testCases = []string{
+		"",
+		"unknown",
+		"int",
+		"int:5",
+		"int:a:5",
+		"int:5:b",
+		"int:5:1",
+		"str",
+		"str:x",
+		"str:-1",
+		"str:2000000000",
+	}
+	for _, spec := range testCases {
+		_, err := getRandomValue(spec)
+		if err == nil {
+			t.Error(fmt.Errorf("an error was expected for %s", spec))
+		}
+	}
+}
+
+func TestGetRandomTemplateValue(t *testing.T) {
+	testVars = make(map[string]interface{})
+	defer func() { testVars = nil }()
+
+	first, ok := getTemplateValue("~rd:int:1:1000=quantity")
+	if !ok || testVars["quantity"] != first {
+		t.Error(fmt.Errorf("the random value should be stored: %v", testVars))
+	}
+	second, ok := getTemplateValue("~rd:uuid4")
+	if !ok {
+		t.Error(fmt.Errorf("the template was expected"))
+	}
+	list := testVars[randomVar].([]interface{})
+	if len(list) != 2 || list[0] != first || list[1] != second {
+		t.Error(fmt.Errorf("the random values should be recorded: %v", list))
+	}
+
+	val, ok := getTemplateValue("~rd:invalid=name")
+	if !ok || val != nil {
+		t.Error(fmt.Errorf("Found different value than expected: %v", val))
+	}
+	if _, exist := testVars["name"]; exist {
+		t.Error(fmt.Errorf("the invalid value should not be stored"))
+	}
+}
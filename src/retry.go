@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// TestRetry defines the retry policy of a test entry, used to repeat the request until the response matches
+type TestRetry struct {
+	MaxAttempts int    `json:"maxAttempts"` // maximum number of attempts, including the first one (0 = limited by the deadline)
+	Delay       int    `json:"delay"`       // delay before the second attempt in milliseconds (min RetryMinDelay)
+	Backoff     string `json:"backoff"`     // "fixed" (default) to always wait the same delay, or "exponential" to double the delay after each attempt
+	MaxDelay    int    `json:"maxDelay"`    // maximum delay between attempts in milliseconds (0 = RetryMaxDelay)
+	Deadline    int    `json:"deadline"`    // maximum time in milliseconds since the first attempt to start a new attempt (0 = no limit)
+}
+
+// StepAttempts contains the number of attempts of a test entry with a retry policy
+type StepAttempts struct {
+	Step     string `json:"step"`     // step name, or topic and index
+	Attempts int    `json:"attempts"` // number of executed attempts
+}
+
+// testAttempts contains the number of attempts of the entries with a retry policy in the current test
+var testAttempts []StepAttempts
+
+// check returns an error if the retry policy is not valid
+func (r *TestRetry) check() error {
+	if r.MaxAttempts < 0 || r.Delay < 0 || r.MaxDelay < 0 || r.Deadline < 0 {
+		return fmt.Errorf("the retry values must be >= 0")
+	}
+	if r.MaxAttempts == 0 && r.Deadline == 0 {
+		return fmt.Errorf("the retry policy requires the maxAttempts or the deadline")
+	}
+	if r.Backoff != "" && r.Backoff != "fixed" && r.Backoff != "exponential" {
+		return fmt.Errorf("invalid retry backoff (fixed or exponential): %s", r.Backoff)
+	}
+	return nil
+}
+
+// next returns the delay before the next attempt, or false if no more attempts are allowed
+func (r *TestRetry) next(attempts int, start time.Time) (time.Duration, bool) {
+	if r == nil || (r.MaxAttempts > 0 && attempts >= r.MaxAttempts) || (r.MaxAttempts == 0 && r.Deadline == 0) {
+		return 0, false
+	}
+	maxDelay := time.Duration(RetryMaxDelay) * time.Millisecond
+	if r.MaxDelay > 0 {
+		maxDelay = time.Duration(r.MaxDelay) * time.Millisecond
+	}
+	// the delay is never below the minimum, to avoid retrying in a tight loop
+	minDelay := time.Duration(RetryMinDelay) * time.Millisecond
+	if maxDelay < minDelay {
+		maxDelay = minDelay
+	}
+	delay := time.Duration(r.Delay) * time.Millisecond
+	if delay < minDelay {
+		delay = minDelay
+	}
+	if r.Backoff == "exponential" {
+		for i := 1; i < attempts && delay < maxDelay; i++ {
+			delay *= 2
+		}
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	if r.Deadline > 0 && time.Since(start)+delay > time.Duration(r.Deadline)*time.Millisecond {
+		return 0, false
+	}
+	return delay, true
+}
+
+// checkRetryPolicies returns an error if a retry policy of the test is not valid
+func checkRetryPolicies(def TestFile) error {
+	if def.Defaults.Retry != nil {
+		if err := def.Defaults.Retry.check(); err != nil {
+			return fmt.Errorf("defaults: %v", err)
+		}
+	}
+	for _, entries := range []TestEntries{def.Setup, def.Steps, def.Teardown} {
+		for _, msg := range entries {
+			if msg.Retry == nil {
+				continue
+			}
+			if err := msg.Retry.check(); err != nil {
+				return fmt.Errorf("%s: %v", msg.Source, err)
+			}
+		}
+	}
+	return nil
+}
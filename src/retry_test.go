@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryNext(t *testing.T) {
+	var none *TestRetry
+	if _, ok := none.next(1, time.Now()); ok {
+		t.Error(fmt.Errorf("no retry was expected without a policy"))
+	}
+
+	tests := []struct {
+		retry    TestRetry
+		attempts int
+		delay    time.Duration
+		ok       bool
+	}{
+		{TestRetry{MaxAttempts: 3, Delay: 10}, 1, 10 * time.Millisecond, true},
+		{TestRetry{MaxAttempts: 3, Delay: 10}, 2, 10 * time.Millisecond, true},
+		{TestRetry{MaxAttempts: 3, Delay: 10}, 3, 0, false},
+		{TestRetry{MaxAttempts: 10, Delay: 10, Backoff: "exponential"}, 4, 80 * time.Millisecond, true},
+		{TestRetry{MaxAttempts: 10, Delay: 10, Backoff: "exponential", MaxDelay: 50}, 4, 50 * time.Millisecond, true},
+		{TestRetry{MaxAttempts: 1000, Delay: 10, Backoff: "exponential"}, 900, RetryMaxDelay * time.Millisecond, true},
+		{TestRetry{Deadline: 100, Delay: 10}, 50, 10 * time.Millisecond, true},
+		{TestRetry{Deadline: 100, Delay: 200}, 1, 0, false},
+		{TestRetry{}, 1, 0, false},
+		// the policies without delay wait the minimum delay, instead of retrying in a tight loop
+		{TestRetry{Deadline: 100}, 1, RetryMinDelay * time.Millisecond, true},
+		{TestRetry{MaxAttempts: 10, Delay: 1, Backoff: "exponential"}, 3, 4 * RetryMinDelay * time.Millisecond, true},
+		{TestRetry{MaxAttempts: 3, Delay: 100, MaxDelay: 1}, 1, RetryMinDelay * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		delay, ok := tt.retry.next(tt.attempts, time.Now())
+		if delay != tt.delay || ok != tt.ok {
+			t.Error(fmt.Errorf("%+v: found different value than expected: %v %v", tt.retry, delay, ok))
+		}
+	}
+}
+
+func TestRetryDeadlineWithoutDelay(t *testing.T) {
+	retry := TestRetry{Deadline: 100}
+	start := time.Now()
+	attempts := 1
+	for {
+		delay, ok := retry.next(attempts, start)
+		if !ok {
+			break
+		}
+		time.Sleep(delay)
+		attempts++
+	}
+	// about 10 attempts in 100 ms, instead of thousands
+	if attempts > 100/RetryMinDelay+1 {
+		t.Error(fmt.Errorf("too many attempts without delay: %d", attempts))
+	}
+}
+
+func TestCheckRetryPolicies(t *testing.T) {
+	valid := []TestRetry{{MaxAttempts: 1}, {Deadline: 1000, Backoff: "exponential"}, {MaxAttempts: 3, Backoff: "fixed"}}
+	for _, retry := range valid {
+		r := retry
+		if err := checkRetryPolicies(TestFile{Steps: TestEntries{{Retry: &r}}}); err != nil {
+			t.Error(fmt.Errorf("%+v: an error was not expected: %v", retry, err))
+		}
+	}
+	invalid := []TestRetry{{}, {MaxAttempts: -1}, {MaxAttempts: 2, Backoff: "linear"}}
+	for _, retry := range invalid {
+		r := retry
+		if err := checkRetryPolicies(TestFile{Teardown: TestEntries{{Retry: &r, Source: "test_x.json:teardown[0]"}}}); err == nil || !strings.HasPrefix(err.Error(), "test_x.json:teardown[0]: ") {
+			t.Error(fmt.Errorf("%+v: an error was expected, found: %v", retry, err))
+		}
+		if err := checkRetryPolicies(TestFile{Defaults: TestDefaults{Retry: &r}}); err == nil {
+			t.Error(fmt.Errorf("%+v: an error was expected", retry))
+		}
+	}
+}
+
+func TestExecTestRetry(t *testing.T) {
+	initNatsBus("nats://127.0.0.1:4222")
+	calls := 0
+	err := RegisterMatcher("eventually", MatcherFunc(func(arg string, actual interface{}) error {
+		calls++
+		if fmt.Sprint(calls) != arg {
+			return fmt.Errorf("not yet")
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	defer delete(matchers, "eventually")
+
+	def := TestFile{Steps: TestEntries{{
+		Name:     "poll",
+		Topic:    "@.retry.test",
+		Request:  map[string]interface{}{"status": "SHIPPED"},
+		Response: map[string]interface{}{"status": "~eventually:3"},
+		Capture:  map[string]string{"status": "Response.status"},
+		Retry:    &TestRetry{MaxAttempts: 5, Delay: 1, Backoff: "exponential"},
+	}}}
+	err = execTestFile(def, nil)
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+	if len(testAttempts) != 1 || testAttempts[0] != (StepAttempts{Step: "poll", Attempts: 3}) || testVars["status"] != "SHIPPED" {
+		t.Error(fmt.Errorf("found different attempts than expected: %v", testAttempts))
+	}
+
+	calls = 0
+	def.Steps[0].Retry = nil
+	def.Steps[0].Name = ""
+	def.Defaults.Retry = &TestRetry{MaxAttempts: 2, Delay: 1}
+	err = execTestFile(def, nil)
+	if err == nil || !strings.HasSuffix(err.Error(), "(after 2 attempts)") {
+		t.Error(fmt.Errorf("an error was expected, found: %v", err))
+	}
+	if len(testAttempts) != 1 || testAttempts[0] != (StepAttempts{Step: "@.retry.test [0]", Attempts: 2}) {
+		t.Error(fmt.Errorf("found different attempts than expected: %v", testAttempts))
+	}
+
+	calls = 0
+	def.Defaults.Retry = nil
+	err = execTestFile(def, nil)
+	if err == nil || calls != 1 || len(testAttempts) != 0 {
+		t.Error(fmt.Errorf("a single attempt was expected: %d %v", calls, err))
+	}
+}
@@ -55,6 +55,7 @@ func startServer(address string) error {
 
 	// subscribe to SIGINT signals
 	signal.Notify(stopServerChan, os.Interrupt)
+	defer signal.Stop(stopServerChan)
 
 	server := &http.Server{
 		Addr:     address,
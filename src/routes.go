@@ -27,6 +27,12 @@ var routes = Routes{
 		test,
 		"Execute the specified test",
 	},
+	Route{
+		"POST",
+		"/cancel",
+		canceltest,
+		"Cancel the test in progress (the teardown entries are still executed)",
+	},
 	Route{
 		"GET",
 		"/reload",
@@ -39,6 +45,12 @@ var routes = Routes{
 		newtest,
 		"Load and execute the specified test configuration",
 	},
+	Route{
+		"POST",
+		"/validate/:name",
+		validatetest,
+		"Validate the specified test configuration without loading or executing it",
+	},
 	Route{
 		"DELETE",
 		"/delete/:name",
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// validateSchema validates the actual value against the specified JSON Schema file (draft-07 or 2020-12)
+func validateSchema(file string, actual interface{}) error {
+	path, err := findConfigFile(file)
+	if err != nil {
+		return err
+	}
+	compiler := jsonschema.NewCompiler()
+	schema, err := compiler.Compile(path)
+	if err != nil {
+		return fmt.Errorf("unable to load the JSON schema %s: %v", file, err)
+	}
+	err = schema.Validate(actual)
+	if err == nil {
+		return nil
+	}
+	verr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return fmt.Errorf("unable to validate the JSON schema %s: %v", file, err)
+	}
+	return getFormattedSchemaError(verr, actual)
+}
+
+// findConfigFile returns the path of the specified file, searching relative paths in the configuration directories
+func findConfigFile(file string) (string, error) {
+	if filepath.IsAbs(file) {
+		return file, nil
+	}
+	for _, cpath := range ConfigPath {
+		path := filepath.Join(os.ExpandEnv(cpath), file)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("unable to find the file %s in the configuration directories", file)
+}
+
+// getFormattedSchemaError returns a json string containing the list of the schema validation errors
+func getFormattedSchemaError(verr *jsonschema.ValidationError, actual interface{}) error {
+	var errList []compareError
+	for _, leaf := range getSchemaErrorLeaves(verr) {
+		errList = append(errList, compareError{
+			Error:    leaf.Message,
+			Pointer:  leaf.InstanceLocation,
+			Expected: leaf.KeywordLocation,
+			Actual:   getPointerValue(leaf.InstanceLocation, actual),
+		})
+	}
+	errmsg, err := json.Marshal(errList)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+	return fmt.Errorf("%s", string(errmsg))
+}
+
+// getSchemaErrorLeaves returns the most specific validation errors
+func getSchemaErrorLeaves(verr *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(verr.Causes) == 0 {
+		return []*jsonschema.ValidationError{verr}
+	}
+	var leaves []*jsonschema.ValidationError
+	for _, cause := range verr.Causes {
+		leaves = append(leaves, getSchemaErrorLeaves(cause)...)
+	}
+	return leaves
+}
+
+// getPointerValue returns the value identified by the JSON pointer (RFC 6901) or nil if not found
+func getPointerValue(pointer string, data interface{}) interface{} {
+	if pointer == "" {
+		return data
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		switch value := data.(type) {
+		case map[string]interface{}:
+			data = value[token]
+		case []interface{}:
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx >= len(value) {
+				return nil
+			}
+			data = value[idx]
+		default:
+			return nil
+		}
+	}
+	return data
+}
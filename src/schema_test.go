@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidateSchema(t *testing.T) {
+	var data interface{}
+	_ = json.Unmarshal([]byte(`{"integer":123,"name":"alpha","array":[{"key1":"a","key2":"b"}],"submap":{}}`), &data)
+	err := validateSchema("schema_@internal.json", data)
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+}
+
+func TestValidateSchemaErrors(t *testing.T) {
+	var data interface{}
+	_ = json.Unmarshal([]byte(`{"integer":"123","name":"alpha","array":[{"key1":"a"}]}`), &data)
+	err := validateSchema("schema_@internal.json", data)
+	if err == nil {
+		t.Error(fmt.Errorf("an error was expected"))
+		return
+	}
+	var errList []compareError
+	if jerr := json.Unmarshal([]byte(err.Error()), &errList); jerr != nil {
+		t.Error(fmt.Errorf("the error should be a JSON list: %v", jerr))
+		return
+	}
+	pointers := make(map[string]interface{})
+	for _, e := range errList {
+		pointers[e.Pointer] = e.Actual
+	}
+	if pointers["/integer"] != "123" {
+		t.Error(fmt.Errorf("expected error for /integer: %v", err))
+	}
+	if _, ok := pointers["/array/0"]; !ok {
+		t.Error(fmt.Errorf("expected error for /array/0: %v", err))
+	}
+	if _, ok := pointers[""]; !ok {
+		t.Error(fmt.Errorf("expected error for the missing submap: %v", err))
+	}
+}
+
+func TestValidateSchemaFileErrors(t *testing.T) {
+	err := validateSchema("schema_missing.json", nil)
+	if err == nil || !strings.Contains(err.Error(), "unable to find") {
+		t.Error(fmt.Errorf("an error was expected: %v", err))
+	}
+	err = validateSchema("test_@internal.json", nil)
+	if err == nil || !strings.Contains(err.Error(), "unable to load") {
+		t.Error(fmt.Errorf("an error was expected: %v", err))
+	}
+}
+
+func TestGetPointerValue(t *testing.T) {
+	var data interface{}
+	_ = json.Unmarshal([]byte(`{"a":{"b/c":[1,{"d~e":"f"}]}}`), &data)
+	if v := getPointerValue("/a/b~1c/1/d~0e", data); v != "f" {
+		t.Error(fmt.Errorf("Found different value than expected: %v", v))
+	}
+	if v := getPointerValue("/a/b~1c/5", data); v != nil {
+		t.Error(fmt.Errorf("Found different value than expected: %v", v))
+	}
+	if v := getPointerValue("/a/x/y", data); v != nil {
+		t.Error(fmt.Errorf("Found different value than expected: %v", v))
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// tagExpr is a boolean expression on the test tags
+type tagExpr interface {
+	eval(tags map[string]bool) bool
+}
+
+// tagName is true if the test has the tag
+type tagName string
+
+// tagNot negates the expression
+type tagNot struct {
+	expr tagExpr
+}
+
+// tagAnd is true if both expressions are true
+type tagAnd struct {
+	left, right tagExpr
+}
+
+// tagOr is true if at least one expression is true
+type tagOr struct {
+	left, right tagExpr
+}
+
+func (e tagName) eval(tags map[string]bool) bool { return tags[string(e)] }
+func (e tagNot) eval(tags map[string]bool) bool  { return !e.expr.eval(tags) }
+func (e tagAnd) eval(tags map[string]bool) bool  { return e.left.eval(tags) && e.right.eval(tags) }
+func (e tagOr) eval(tags map[string]bool) bool   { return e.left.eval(tags) || e.right.eval(tags) }
+
+// tagParser is a recursive descent parser for the tag expressions with the following grammar:
+//
+//	expr  = and { "||" and }
+//	and   = unary { "&&" unary }
+//	unary = "!" unary | "(" expr ")" | TAG
+type tagParser struct {
+	tokens []string
+	pos    int
+}
+
+// testFilter selects the tests by including and excluding the ones matching the tag expressions
+type testFilter struct {
+	include tagExpr // if not nil, only the tests matching this expression are selected
+	exclude tagExpr // if not nil, the tests matching this expression are discarded
+}
+
+// parseTagExpr parses a tag expression (e.g. "smoke && !slow"), returning nil for an empty expression
+func parseTagExpr(expr string) (tagExpr, error) {
+	tokens, err := tokenizeTagExpr(expr)
+	if err != nil || len(tokens) == 0 {
+		return nil, err
+	}
+	p := &tagParser{tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in the tag expression: %s", p.tokens[p.pos], expr)
+	}
+	return e, nil
+}
+
+// tokenizeTagExpr splits the tag expression into operators, parentheses and tag names
+func tokenizeTagExpr(expr string) ([]string, error) {
+	var tokens []string
+	runes := []rune(expr)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+		case r == '!' || r == '(' || r == ')':
+			tokens = append(tokens, string(r))
+		case (r == '&' || r == '|') && i+1 < len(runes) && runes[i+1] == r:
+			tokens = append(tokens, string(runes[i:i+2]))
+			i++
+		case isTagRune(r):
+			start := i
+			for i+1 < len(runes) && isTagRune(runes[i+1]) {
+				i++
+			}
+			tokens = append(tokens, string(runes[start:i+1]))
+		default:
+			return nil, fmt.Errorf("invalid character %q in the tag expression: %s", r, expr)
+		}
+	}
+	return tokens, nil
+}
+
+// isTagRune returns true if the character can be used in a tag name
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-.:/@", r)
+}
+
+// next returns the current token and moves to the next one
+func (p *tagParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	p.pos++
+	return p.tokens[p.pos-1]
+}
+
+// peek returns the current token
+func (p *tagParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+// parseOr parses a sequence of "&&" expressions separated by "||"
+func (p *tagParser) parseOr() (tagExpr, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peek() == "||" {
+		p.next()
+		var right tagExpr
+		right, err = p.parseAnd()
+		left = tagOr{left, right}
+	}
+	return left, err
+}
+
+// parseAnd parses a sequence of unary expressions separated by "&&"
+func (p *tagParser) parseAnd() (tagExpr, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.peek() == "&&" {
+		p.next()
+		var right tagExpr
+		right, err = p.parseUnary()
+		left = tagAnd{left, right}
+	}
+	return left, err
+}
+
+// parseUnary parses a negation, an expression in parentheses or a tag name
+func (p *tagParser) parseUnary() (tagExpr, error) {
+	tok := p.next()
+	switch tok {
+	case "":
+		return nil, fmt.Errorf("unexpected end of the tag expression")
+	case "!":
+		e, err := p.parseUnary()
+		return tagNot{e}, err
+	case "(":
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis in the tag expression")
+		}
+		return e, nil
+	case ")", "&&", "||":
+		return nil, fmt.Errorf("unexpected %q in the tag expression", tok)
+	}
+	return tagName(tok), nil
+}
+
+// newTestFilter returns a test filter from the include and exclude tag expressions
+func newTestFilter(include, exclude string) (*testFilter, error) {
+	inc, err := parseTagExpr(include)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include expression: %v", err)
+	}
+	exc, err := parseTagExpr(exclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude expression: %v", err)
+	}
+	return &testFilter{include: inc, exclude: exc}, nil
+}
+
+// match returns true if a test with the specified tags is selected by the filter
+func (f *testFilter) match(tags []string) bool {
+	if f == nil {
+		return true
+	}
+	set := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		set[tag] = true
+	}
+	return (f.include == nil || f.include.eval(set)) && (f.exclude == nil || !f.exclude.eval(set))
+}
+
+// selectTests returns the sorted names of the tests selected by the name ("all" for all the tests, excluding the internal ones) and the filter
+func selectTests(name string, filter *testFilter) ([]string, error) {
+	var names []string
+	if name == "all" {
+		for key := range testMap {
+			if key[0] != '@' { // exclude internal tests
+				names = append(names, key)
+			}
+		}
+		sort.Strings(names)
+	} else {
+		if _, exist := testMap[name]; !exist {
+			return nil, fmt.Errorf("unable to find the test %s", name)
+		}
+		names = []string{name}
+	}
+	selected := []string{}
+	for _, key := range names {
+		if filter.match(testDefs[key].Tags) {
+			selected = append(selected, key)
+		}
+	}
+	return selected, nil
+}
+
+// getTestTags returns the tags of each test that has at least one tag
+func getTestTags() map[string][]string {
+	tags := make(map[string][]string)
+	for name, def := range testDefs {
+		if len(def.Tags) > 0 {
+			tags[name] = def.Tags
+		}
+	}
+	return tags
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseTagExpr(t *testing.T) {
+	tags := []string{"smoke", "orders", "v2.1"}
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{"smoke", true},
+		{"slow", false},
+		{"!slow", true},
+		{"smoke && !slow", true},
+		{"smoke && slow", false},
+		{"slow || orders", true},
+		{"!(smoke || slow)", false},
+		{"slow && orders || smoke", true},
+		{"slow && (orders || smoke)", false},
+		{"!!smoke&&v2.1", true},
+	}
+	for _, tt := range tests {
+		filter, err := newTestFilter(tt.expr, "")
+		if err != nil {
+			t.Error(fmt.Errorf("%s: an error was not expected: %v", tt.expr, err))
+			continue
+		}
+		if filter.match(tags) != tt.expected {
+			t.Error(fmt.Errorf("%s: expected %v", tt.expr, tt.expected))
+		}
+	}
+
+	for _, expr := range []string{"smoke &&", "(smoke", "smoke)", "smoke & slow", "smoke slow", "!", "|| smoke", "smoke,slow"} {
+		if _, err := parseTagExpr(expr); err == nil {
+			t.Error(fmt.Errorf("%s: an error was expected", expr))
+		}
+	}
+
+	if e, err := parseTagExpr("  "); e != nil || err != nil {
+		t.Error(fmt.Errorf("an empty expression was expected: %v %v", e, err))
+	}
+}
+
+func TestTestFilter(t *testing.T) {
+	filter, err := newTestFilter("smoke || orders", "slow")
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	tests := []struct {
+		tags     []string
+		expected bool
+	}{
+		{[]string{"smoke"}, true},
+		{[]string{"orders", "slow"}, false},
+		{[]string{"users"}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if filter.match(tt.tags) != tt.expected {
+			t.Error(fmt.Errorf("%v: expected %v", tt.tags, tt.expected))
+		}
+	}
+	var none *testFilter
+	if !none.match(nil) {
+		t.Error(fmt.Errorf("a nil filter should match all the tests"))
+	}
+	if _, err = newTestFilter("", "(slow"); err == nil {
+		t.Error(fmt.Errorf("an error was expected"))
+	}
+}
+
+func TestSelectTests(t *testing.T) {
+	oldTestMap, oldNames, oldDefs := testMap, testNames, testDefs
+	testMap = make(map[string]TestEntries)
+	testNames = make([]string, 0)
+	testDefs = make(map[string]TestFile)
+	defer func() {
+		testMap, testNames, testDefs = oldTestMap, oldNames, oldDefs
+	}()
+	storeTest("orders", TestFile{Tags: []string{"smoke", "orders"}})
+	storeTest("users", TestFile{Tags: []string{"users", "slow"}})
+	storeTest("legacy", TestFile{})
+	storeTest("@internal", TestFile{Tags: []string{"smoke"}})
+
+	filter, _ := newTestFilter("smoke || users", "slow")
+	tests := []struct {
+		name     string
+		filter   *testFilter
+		expected []string
+	}{
+		{"all", nil, []string{"legacy", "orders", "users"}},
+		{"all", filter, []string{"orders"}},
+		{"users", filter, []string{}},
+		{"@internal", filter, []string{"@internal"}},
+	}
+	for _, tt := range tests {
+		names, err := selectTests(tt.name, tt.filter)
+		if err != nil || !reflect.DeepEqual(names, tt.expected) {
+			t.Error(fmt.Errorf("%s: found different value than expected: %v %v", tt.name, names, err))
+		}
+	}
+	if _, err := selectTests("missing", nil); err == nil {
+		t.Error(fmt.Errorf("an error was expected"))
+	}
+	expected := map[string][]string{"orders": {"smoke", "orders"}, "users": {"users", "slow"}, "@internal": {"smoke"}}
+	if tags := getTestTags(); !reflect.DeepEqual(tags, expected) {
+		t.Error(fmt.Errorf("found different value than expected: %v", tags))
+	}
+}
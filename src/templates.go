@@ -3,20 +3,15 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"math"
-	"os/exec"
+	"os"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
-	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
-// validTransfCommandMap is a map containing the list of valid transformation commands
-var isValidTransfCmd = make(map[string]bool)
-
 // jsonOpenMark is the string identifying the beginning of a JSON string
 const jsonStartMark = "#@~"
 
@@ -35,7 +30,10 @@ func replaceTemplates(obj interface{}) (interface{}, error) {
 	// create a copy
 	copy := reflect.New(original.Type()).Elem()
 	// replace templates
-	processTemplates(copy, original)
+	err := processTemplates(copy, original)
+	if err != nil {
+		return nil, err
+	}
 	// encode the copy interface as json
 	jsoncopy, err := json.Marshal(copy.Interface())
 	if err != nil {
@@ -65,142 +63,198 @@ func replaceTemplates(obj interface{}) (interface{}, error) {
 
 // processTemplates find and replace individual templates
 // NOTE: some of this code based on https://gist.github.com/hvoecking/10772475 (MIT LICENSE)
-func processTemplates(copy, original reflect.Value) {
+func processTemplates(copy, original reflect.Value) error {
 	switch original.Kind() {
 	// The first cases handle nested structures and process them recursively
 
 	// invalid kind
 	case reflect.Invalid:
-		return
+		return nil
 
 	// If it is a pointer we need to unwrap and call once again
 	case reflect.Ptr:
-		processTemplatePtr(copy, original)
+		return processTemplatePtr(copy, original)
 
 	// If it is an interface (which is very similar to a pointer), do basically the
 	// same as for the pointer. Though a pointer is not the same as an interface so
 	// note that we have to call Elem() after creating a new object because otherwise
 	// we would end up with an actual pointer
 	case reflect.Interface:
-		processTemplateInterface(copy, original)
+		return processTemplateInterface(copy, original)
 
 	// If it is a struct we process each field
 	case reflect.Struct:
-		processTemplateStruct(copy, original)
+		return processTemplateStruct(copy, original)
 
 	// If it is a slice we create a new slice and process each element
 	case reflect.Slice:
-		processTemplateSlice(copy, original)
+		return processTemplateSlice(copy, original)
 
 	// If it is a map we create a new map and process each value
 	case reflect.Map:
-		processTemplateMap(copy, original)
+		return processTemplateMap(copy, original)
 
 	// Otherwise we cannot traverse anywhere so this finishes the recursion
 
 	// If it is a string process, check if it is a template
 	case reflect.String:
-		processTemplateString(copy, original)
+		return processTemplateString(copy, original)
 
 	// And everything else will simply be taken from the original
 	default:
 		copy.Set(original)
 	}
+	return nil
 }
 
 // processTemplatePtr process the Ptr case
-func processTemplatePtr(copy, original reflect.Value) {
+func processTemplatePtr(copy, original reflect.Value) error {
 	// To get the actual value of the original we have to call Elem()
 	// At the same time this unwraps the pointer so we don't end up in
 	// an infinite recursion
 	originalValue := original.Elem()
 	// Check if the pointer is nil
 	if !originalValue.IsValid() {
-		return
+		return nil
 	}
 	// Allocate a new object and set the pointer to it
 	copy.Set(reflect.New(originalValue.Type()))
 	// Unwrap the newly created pointer
-	processTemplates(copy.Elem(), originalValue)
+	return processTemplates(copy.Elem(), originalValue)
 }
 
 // processTemplateInterface process the Interface case
-func processTemplateInterface(copy, original reflect.Value) {
+func processTemplateInterface(copy, original reflect.Value) error {
 	// Get rid of the wrapping interface
 	originalValue := original.Elem()
 	// Check if the pointer is nil
 	if !originalValue.IsValid() {
-		return
+		return nil
 	}
 	// Create a new object. Now new gives us a pointer, but we want the value it
 	// points to, so we have to call Elem() to unwrap it
 	copyValue := reflect.New(originalValue.Type()).Elem()
-	processTemplates(copyValue, originalValue)
+	err := processTemplates(copyValue, originalValue)
 	copy.Set(copyValue)
+	return err
 }
 
 // processTemplateStruct process the Struct case
-func processTemplateStruct(copy, original reflect.Value) {
+func processTemplateStruct(copy, original reflect.Value) error {
 	for i := 0; i < original.NumField(); i++ {
-		processTemplates(copy.Field(i), original.Field(i))
+		if err := processTemplates(copy.Field(i), original.Field(i)); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // processTemplateSlice process the Slice case
-func processTemplateSlice(copy, original reflect.Value) {
+func processTemplateSlice(copy, original reflect.Value) error {
 	copy.Set(reflect.MakeSlice(original.Type(), original.Len(), original.Cap()))
 	for i := 0; i < original.Len(); i++ {
-		processTemplates(copy.Index(i), original.Index(i))
+		if err := processTemplates(copy.Index(i), original.Index(i)); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // processTemplateMap process the Map case
-func processTemplateMap(copy, original reflect.Value) {
+func processTemplateMap(copy, original reflect.Value) error {
 	copy.Set(reflect.MakeMap(original.Type()))
 	for _, key := range original.MapKeys() {
 		originalValue := original.MapIndex(key)
 		// New gives us a pointer, but again we want the value
 		copyValue := reflect.New(originalValue.Type()).Elem()
-		processTemplates(copyValue, originalValue)
+		if err := processTemplates(copyValue, originalValue); err != nil {
+			return err
+		}
 		copy.SetMapIndex(key, copyValue)
 	}
+	return nil
 }
 
 // processTemplateString process the String case
-func processTemplateString(copy, original reflect.Value) {
+func processTemplateString(copy, original reflect.Value) error {
 	value := original.Interface().(string)
-	tmark := value[0:int(math.Min(float64(len(value)), float64(4)))] // template marker
-	if tmark == "~ts:" {
-		// replace the template with the current time
-		t := time.Now().UTC()
-		// extract time format
-		timeFormat := value[4:]
-		if timeFormat != "" {
-			copy.SetString(t.Format(timeFormat))
-		} else {
-			// unix timestamp in seconds
-			jenc, err := json.Marshal(int32(t.Unix()))
-			if err == nil {
-				copy.SetString(jsonStartMark + string(jenc) + jsonEndMark)
-			}
-		}
-	} else if tmark == "~pv:" {
-		// replace the template with the real value
-		newval := getFieldValue(value[4:], testCache).Interface()
-		if reflect.TypeOf(newval).Kind() == reflect.String {
-			// the replacement value is also a string
-			copy.SetString(newval.(string))
-		} else {
-			// encode the replacement value as JSON string (to be decoded later)
-			jenc, err := json.Marshal(newval)
-			if err == nil {
-				copy.SetString(jsonStartMark + string(jenc) + jsonEndMark)
-			}
-		}
-	} else {
+	p, arg, ok := getTemplateProvider(value)
+	if !ok {
 		// this is not a template; copy the value
 		copy.Set(original)
+		return nil
+	}
+	newval, err := p.Value(arg)
+	if err != nil {
+		return fmt.Errorf("unable to process the template %s: %v", value, err)
+	}
+	if newval != nil && reflect.TypeOf(newval).Kind() == reflect.String {
+		// the replacement value is also a string
+		copy.SetString(reflect.ValueOf(newval).String())
+		return nil
+	}
+	// encode the replacement value as JSON string (to be decoded later)
+	jenc, err := json.Marshal(newval)
+	if err == nil {
+		copy.SetString(jsonStartMark + string(jenc) + jsonEndMark)
+	}
+	return nil
+}
+
+// getTemplateValue returns the value of the template and true, or false if the string is not a template;
+// the processing errors are logged and return a nil value
+func getTemplateValue(value string) (interface{}, bool) {
+	p, arg, ok := getTemplateProvider(value)
+	if !ok {
+		return nil, false
+	}
+	newval, err := p.Value(arg)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"template": value,
+			"error":    err,
+		}).Error("unable to process the template")
 	}
+	return newval, true
+}
+
+// init registers the built-in template prefixes
+func init() {
+	// current time of the test run
+	mustRegisterTemplate("ts", getTimestampValue)
+	// real value of a previous step
+	mustRegisterTemplate("pv", func(arg string) (interface{}, error) {
+		return getValidInterface(getFieldValue(arg, testCache)), nil
+	})
+	// random value
+	mustRegisterTemplate("rd", getRandomTemplateValue)
+	// output of the Go text/template
+	mustRegisterTemplate("tp", getGoTemplateValue)
+	// signed JSON Web Token
+	mustRegisterTemplate("jw", getJWTTemplateValue)
+	// value of a test parameter
+	mustRegisterTemplate("pm", func(arg string) (interface{}, error) {
+		return getValidInterface(getFieldValue(arg, testParams)), nil
+	})
+	// value of a captured variable
+	mustRegisterTemplate("var", func(arg string) (interface{}, error) {
+		return getValidInterface(getFieldValue(arg, testVars)), nil
+	})
+	// value of an environment variable
+	mustRegisterTemplate("env", func(arg string) (interface{}, error) {
+		if newval, ok := os.LookupEnv(arg); ok {
+			return newval, nil
+		}
+		return nil, nil
+	})
+}
+
+// getValidInterface returns the interface of the value or nil if the value is not valid
+func getValidInterface(value reflect.Value) interface{} {
+	if !value.IsValid() {
+		return nil
+	}
+	return value.Interface()
 }
 
 // getFieldValue returns the data value specified by the path
@@ -221,13 +275,23 @@ func getFieldValue(path string, data interface{}) reflect.Value {
 		} else if cache.Kind() == reflect.Struct {
 			cache = cache.FieldByName(key)
 		} else if cache.Kind() == reflect.Slice {
-			idx, _ := strconv.Atoi(key)
+			idx, err := strconv.Atoi(key)
+			if err != nil {
+				// search the item by name
+				idx = getNamedItemIndex(key, cache)
+			}
+			if idx < 0 || idx >= cache.Len() {
+				return reflect.Value{}
+			}
 			cache = cache.Index(idx)
 		}
 	}
-	// process the transformation (if any)
+	if !cache.IsValid() {
+		return cache
+	}
+	// process the transformations (if any)
 	if len(parts) == 2 {
-		val, err := execTransfCmd(parts[1], cache)
+		val, err := execTransfChain(parts[1], cache)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"error": err,
@@ -238,6 +302,24 @@ func getFieldValue(path string, data interface{}) reflect.Value {
 	return cache
 }
 
+// getNamedItemIndex returns the index of the first slice item with the specified Name field, or -1 if not found
+func getNamedItemIndex(name string, items reflect.Value) int {
+	for i := 0; i < items.Len(); i++ {
+		item := items.Index(i)
+		if item.Kind() == reflect.Interface || item.Kind() == reflect.Ptr {
+			item = item.Elem()
+		}
+		if item.Kind() != reflect.Struct {
+			continue
+		}
+		field := item.FieldByName("Name")
+		if field.IsValid() && field.Kind() == reflect.String && field.String() == name {
+			return i
+		}
+	}
+	return -1
+}
+
 // execTransfCmd execute the specified command template
 func execTransfCmd(template string, value reflect.Value) (reflect.Value, error) {
 	var strvalue string
@@ -255,9 +337,6 @@ func execTransfCmd(template string, value reflect.Value) (reflect.Value, error)
 	if len(parts) == 1 {
 		return value, fmt.Errorf("the command is missing arguments: %v", template)
 	}
-	if !isValidTransfCmd[parts[0]] {
-		return value, fmt.Errorf("the following command is not valid: %v", parts[0])
-	}
 	args := parts[1:]
 	// search and replace the input argument value (%v)
 	for i := range args {
@@ -266,8 +345,7 @@ func execTransfCmd(template string, value reflect.Value) (reflect.Value, error)
 			break
 		}
 	}
-	/* #nosec */
-	out, err := exec.Command(parts[0], args...).Output()
+	out, err := execCommand(parts[0], args...)
 	if err != nil {
 		return value, fmt.Errorf("unable to run the command: %v -- [%v]", template, err)
 	}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
@@ -155,3 +156,108 @@ func TestExecCmdTemplateErr(t *testing.T) {
 		t.Error(fmt.Errorf("a different return value was expected"))
 	}
 }
+
+func TestGetTemplateValue(t *testing.T) {
+	testCache = testMap["@internal"]
+
+	val, ok := getTemplateValue("~pv:0.Request.name")
+	if !ok || val.(string) != "some string" {
+		t.Error(fmt.Errorf("Found different value than expected: %v", val))
+	}
+
+	val, ok = getTemplateValue("~pv:0.Request.missing")
+	if !ok || val != nil {
+		t.Error(fmt.Errorf("Found different value than expected: %v", val))
+	}
+
+	_, ok = getTemplateValue("~no")
+	if ok {
+		t.Error(fmt.Errorf("the string is not a template"))
+	}
+}
+
+func TestGetTemplateValueVar(t *testing.T) {
+	testVars = map[string]interface{}{
+		"orderId": "A123",
+		"order":   map[string]interface{}{"items": []interface{}{"x", "y"}},
+	}
+	defer func() { testVars = nil }()
+
+	val, ok := getTemplateValue("~var:orderId")
+	if !ok || val.(string) != "A123" {
+		t.Error(fmt.Errorf("Found different value than expected: %v", val))
+	}
+
+	val, ok = getTemplateValue("~var:order.items.1")
+	if !ok || val.(string) != "y" {
+		t.Error(fmt.Errorf("Found different value than expected: %v", val))
+	}
+
+	val, ok = getTemplateValue("~var:order.items.5")
+	if !ok || val != nil {
+		t.Error(fmt.Errorf("Found different value than expected: %v", val))
+	}
+
+	val, ok = getTemplateValue("~var:missing>/bin/echo -n %v")
+	if !ok || val != nil {
+		t.Error(fmt.Errorf("Found different value than expected: %v", val))
+	}
+}
+
+func TestGetTemplateValueParamEnv(t *testing.T) {
+	testParams = map[string]interface{}{
+		"userId": "123",
+		"limits": map[string]interface{}{"max": float64(10)},
+	}
+	defer func() { testParams = nil }()
+
+	val, ok := getTemplateValue("~pm:userId")
+	if !ok || val.(string) != "123" {
+		t.Error(fmt.Errorf("Found different value than expected: %v", val))
+	}
+
+	val, ok = getTemplateValue("~pm:limits.max")
+	if !ok || val.(float64) != 10 {
+		t.Error(fmt.Errorf("Found different value than expected: %v", val))
+	}
+
+	val, ok = getTemplateValue("~pm:missing")
+	if !ok || val != nil {
+		t.Error(fmt.Errorf("Found different value than expected: %v", val))
+	}
+
+	err := os.Setenv("NATSTEST_TEMPLATE_TEST", "alpha")
+	if err != nil {
+		t.Error(fmt.Errorf("An error was not expected: %v", err))
+	}
+	defer func() { _ = os.Unsetenv("NATSTEST_TEMPLATE_TEST") }()
+
+	val, ok = getTemplateValue("~env:NATSTEST_TEMPLATE_TEST")
+	if !ok || val.(string) != "alpha" {
+		t.Error(fmt.Errorf("Found different value than expected: %v", val))
+	}
+
+	val, ok = getTemplateValue("~env:NATSTEST_TEMPLATE_MISSING")
+	if !ok || val != nil {
+		t.Error(fmt.Errorf("Found different value than expected: %v", val))
+	}
+}
+
+func TestGetFieldValueNamed(t *testing.T) {
+	entries := TestEntries{
+		{Name: "login", Response: map[string]interface{}{"token": "T1"}},
+		{Name: "order", Response: map[string]interface{}{"id": "O1"}},
+	}
+	val := getFieldValue("order.Response.id", entries)
+	if val.Interface().(string) != "O1" {
+		t.Error(fmt.Errorf("Found different value than expected: %v", val.Interface()))
+	}
+	val = getFieldValue("login.Response.token", entries)
+	if val.Interface().(string) != "T1" {
+		t.Error(fmt.Errorf("Found different value than expected: %v", val.Interface()))
+	}
+	val = getFieldValue("missing.Response.token", entries)
+	if val.IsValid() {
+		t.Error(fmt.Errorf("An invalid value was expected: %v", val))
+	}
+}
@@ -1,23 +1,86 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 // TestEntry defines a single entry in the test configuration file
 type TestEntry struct {
-	Topic    string      `json:"Topic"`    // topic name
-	Request  interface{} `json:"Request"`  // raw message to be sent (input)
-	Response interface{} `json:"Response"` // expected response message (output)
+	Name      string                 `json:"Name"`      // optional step name, can be used instead of the index in the "~pv:" templates
+	Topic     string                 `json:"Topic"`     // topic name
+	Request   interface{}            `json:"Request"`   // raw message to be sent (input)
+	Response  interface{}            `json:"Response"`  // expected response message (output)
+	Strict    *bool                  `json:"Strict"`    // if true the response can't contain fields or items that are not in the expected message (default: defaults.strict)
+	Schema    string                 `json:"Schema"`    // JSON Schema file used to validate the response message (if any)
+	Assert    []string               `json:"Assert"`    // list of boolean expressions (CEL) to be verified on the response message
+	Capture   map[string]string      `json:"Capture"`   // variables to capture, each with the path of the value in this step (e.g. "Response.data.id")
+	Timeout   int                    `json:"Timeout"`   // maximum time to wait for the response in milliseconds (0 = test or bus default)
+	Include   string                 `json:"Include"`   // name of the fragment to include instead of this entry
+	With      map[string]interface{} `json:"With"`      // parameters of the included fragment
+	Retry     *TestRetry             `json:"Retry"`     // retry policy used to repeat the request until the response matches
+	When      string                 `json:"When"`      // boolean expression (CEL) evaluated before the request: if false the entry is skipped
+	Repeat    int                    `json:"Repeat"`    // number of times the entry is executed, with the iteration number in the "index" variable
+	ForEach   string                 `json:"ForEach"`   // template of an array (e.g. "~pv:list.Response.items"): the entry is executed for each "item" variable
+	Delay     int                    `json:"Delay"`     // time to wait in milliseconds instead of sending a request
+	WaitUntil string                 `json:"WaitUntil"` // template of the time to wait for (RFC 3339 or Unix timestamp) instead of sending a request
+	WaitFor   string                 `json:"WaitFor"`   // subject on which to wait for a message matching the expected response, instead of sending a request
+	Source    string                 `json:"-"`         // location of the entry in the original files (e.g. "test_orders.json:steps[1] > fragment_login.yaml:steps[0]")
 }
 
 // TestEntries is a list of test entries
 type TestEntries []TestEntry
 
+// TestParam defines a parameter of a test
+type TestParam struct {
+	Default  interface{} `json:"default"`  // default value
+	Required bool        `json:"required"` // if true the parameter must be specified when the test runs
+}
+
+// TestParams is a map of test parameters indexed by name
+type TestParams map[string]TestParam
+
+// TestDefaults defines the default options of the test entries
+type TestDefaults struct {
+	Timeout int        `json:"timeout"` // maximum time to wait for each response in milliseconds
+	Strict  bool       `json:"strict"`  // if true the strict mode is enabled for all the responses
+	Retry   *TestRetry `json:"retry"`   // retry policy of the entries that do not define their own
+}
+
+// TestFile defines the object format of a test configuration file
+type TestFile struct {
+	Description string                  `json:"description"` // description of the test
+	Tags        []string                `json:"tags"`        // list of tags used to classify the test
+	Owner       string                  `json:"owner"`       // owner of the test (e.g. team or email address)
+	Defaults    TestDefaults            `json:"defaults"`    // default options of the test entries
+	Params      TestParams              `json:"params"`      // test parameters
+	Setup       TestEntries             `json:"setup"`       // test entries executed before the main steps
+	Steps       TestEntries             `json:"steps"`       // sequence of test entries
+	Teardown    TestEntries             `json:"teardown"`    // test entries always executed at the end, even if a previous step fails
+	Fragments   map[string]TestFragment `json:"fragments"`   // fragments that can be included by the test entries
+	Data        []TestRow               `json:"data"`        // data table: the test is executed once for each row
+	DataFile    string                  `json:"dataFile"`    // CSV, JSON or YAML file containing the data table
+}
+
+// TestResult contains the result of a test execution, or of a single data row for the data-driven tests
+type TestResult struct {
+	Test     string         `json:"test"`               // test name
+	Row      *int           `json:"row,omitempty"`      // index of the data row (starting from 0)
+	Data     TestRow        `json:"data,omitempty"`     // values of the data row
+	Attempts []StepAttempts `json:"attempts,omitempty"` // number of attempts of the entries with a retry policy
+	Skipped  []string       `json:"skipped,omitempty"`  // entries skipped because their condition was false
+	Duration float64        `json:"duration"`           // execution time in seconds
+	Error    string         `json:"error,omitempty"`    // error message (empty if the test succeeded)
+}
+
 // testMap contains the sequence of messages to send and the expected responses
 var testMap map[string]TestEntries
 
@@ -27,61 +90,311 @@ var testCache TestEntries
 // testNames contains the test names that can be used as entry points
 var testNames []string
 
+// testDefs contains the definition of each test, including the metadata, the parameters and the setup and teardown entries
+var testDefs map[string]TestFile
+
+// testParams contains the parameter values of the current test
+var testParams map[string]interface{}
+
+// testClock is the frozen time of the current test run, used by the timestamp templates
+var testClock time.Time
+
+// testStepTime is the time when the request message of the current step was sent
+var testStepTime time.Time
+
+// testVars contains the variables captured during the current test
+var testVars map[string]interface{}
+
+// testFile contains the name and the path of a test or fragment file
+type testFile struct {
+	name string
+	path string
+}
+
 // return a list of configuration test files for each type
 func loadTestMap() error {
 	testMap = make(map[string]TestEntries)
 	testNames = make([]string, 0)
-	// extract the topic name
-	re := regexp.MustCompile(`test_([@a-zA-Z0-9]+)\.json$`)
+	testDefs = make(map[string]TestFile)
+	// load the fragments first, so they can be included by the tests
+	fragments := make(map[string]TestFragment)
+	for _, file := range findTestFiles("fragment_") {
+		raw, err := ioutil.ReadFile(file.path) // #nosec
+		if err != nil {
+			return fmt.Errorf("unable to read the configuration file: %v", err)
+		}
+		err = loadRawFragment(raw, file.name, filepath.Base(file.path), fragments)
+		if err != nil {
+			return fmt.Errorf("unable to decode the fragment file %s: %v", file.path, err)
+		}
+	}
+	testFragments = fragments
+	for _, file := range findTestFiles("test_") {
+		raw, err := ioutil.ReadFile(file.path) // #nosec
+		if err != nil {
+			return fmt.Errorf("unable to read the configuration file: %v", err)
+		}
+		err = loadRawTest(raw, file.name, filepath.Base(file.path))
+		if err != nil {
+			return fmt.Errorf("unable to decode the test file %s: %v", file.path, err)
+		}
+	}
+	if len(testMap) == 0 {
+		return fmt.Errorf("unable to find valid test configuration files")
+	}
+	return nil
+}
+
+// findTestFiles returns the JSON and YAML files named PREFIX + NAME in the configuration directories;
+// when a name is defined more than once, the local files and then the JSON files have priority
+func findTestFiles(prefix string) []testFile {
+	// extract the name and the file format
+	re := regexp.MustCompile(`^` + prefix + `([@a-zA-Z0-9]+)\.(json|yaml|yml)$`)
+	found := make(map[string]bool)
+	var files []testFile
 	// for each configuration directory
 	for _, cpath := range ConfigPath {
-		// find the test files
-		files, _ := filepath.Glob(cpath + "/test_*.json")
-		for _, file := range files {
-			// extract the test name
-			key := re.FindStringSubmatch(file)
-			if _, exist := testMap[key[1]]; !exist {
-				// store the test config file (local files have priority)
-				raw, err := ioutil.ReadFile(file) // #nosec
-				if err != nil {
-					return fmt.Errorf("unable to read the configuration file: %v", err)
-				}
-				err = loadRawJSONTest(raw, key[1])
-				if err != nil {
-					return fmt.Errorf("unable to decode the test file %s: %v", file, err)
+		for _, ext := range []string{"json", "yaml", "yml"} {
+			paths, _ := filepath.Glob(cpath + "/" + prefix + "*." + ext)
+			for _, path := range paths {
+				key := re.FindStringSubmatch(filepath.Base(path))
+				if key == nil || found[key[1]] {
+					continue
 				}
+				found[key[1]] = true
+				files = append(files, testFile{name: key[1], path: path})
 			}
 		}
 	}
-	if len(testMap) == 0 {
-		return fmt.Errorf("unable to find valid test configuration files")
+	return files
+}
+
+// load the test from a JSON string containing either a list of test entries or a TestFile object
+func loadRawJSONTest(raw []byte, name string) error {
+	return loadRawTest(raw, name, "test_"+name+".json")
+}
+
+// loadRawTest decodes the test from the JSON or YAML string (depending on the source file extension),
+// expands the included fragments and stores the test
+func loadRawTest(raw []byte, name string, source string) error {
+	testData, err := decodeRawTest(raw, source)
+	if err != nil {
+		return err
 	}
+	testData, err = expandTestFile(testData, source, testFragments)
+	if err != nil {
+		return err
+	}
+	err = checkRetryPolicies(testData)
+	if err != nil {
+		return err
+	}
+	err = checkFlowControls(testData)
+	if err != nil {
+		return err
+	}
+	testData.Data, err = loadTestData(testData)
+	if err != nil {
+		return err
+	}
+	storeTest(name, testData)
 	return nil
 }
 
-// load the test from a JSON string
-func loadRawJSONTest(raw []byte, name string) (err error) {
-	var testData TestEntries
-	err = json.Unmarshal(raw, &testData)
+// decodeRawTest decodes a JSON or YAML test file depending on the file extension
+func decodeRawTest(raw []byte, file string) (TestFile, error) {
+	switch filepath.Ext(file) {
+	case ".yaml", ".yml":
+		return decodeYAMLTest(raw)
+	}
+	testData, err := decodeJSONTest(raw)
 	if err != nil {
-		return err
+		return testData, getJSONPositionError(raw, err)
+	}
+	return testData, nil
+}
+
+// decodeJSONTest decodes a JSON string containing either a list of test entries or a TestFile object
+func decodeJSONTest(raw []byte) (testData TestFile, err error) {
+	if len(bytes.TrimSpace(raw)) > 0 && bytes.TrimSpace(raw)[0] == '{' {
+		err = json.Unmarshal(raw, &testData)
+	} else {
+		err = json.Unmarshal(raw, &testData.Steps)
 	}
+	return testData, err
+}
+
+// storeTest adds or replaces the test in the test map
+func storeTest(name string, testData TestFile) {
 	_, replace := testMap[name]
-	testMap[name] = testData
+	testMap[name] = testData.Steps
+	testDefs[name] = testData
 	if !replace {
 		testNames = append(testNames, name)
 	}
-	return nil
+}
+
+// positionError is a decoding error with the line and column (starting from 1) of the invalid content
+type positionError struct {
+	Line   int
+	Column int
+	Err    error
+}
+
+// Error returns the error message prefixed by the position
+func (e *positionError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %v", e.Line, e.Column, e.Err)
+}
+
+// getJSONPositionError adds the line and column of the invalid content to a JSON decoding error
+func getJSONPositionError(raw []byte, err error) error {
+	var offset int64
+	switch jerr := err.(type) {
+	case *json.SyntaxError:
+		offset = jerr.Offset
+	case *json.UnmarshalTypeError:
+		offset = jerr.Offset
+	default:
+		return err
+	}
+	line, column := getTextPosition(raw, int(offset)-1)
+	return &positionError{Line: line, Column: column, Err: err}
+}
+
+// getTextPosition returns the line and column (starting from 1) of the byte at the specified offset
+func getTextPosition(raw []byte, offset int) (line int, column int) {
+	if offset > len(raw) {
+		offset = len(raw)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	line = 1 + bytes.Count(raw[:offset], []byte("\n"))
+	column = 1 + utf8.RuneCount(raw[bytes.LastIndexByte(raw[:offset], '\n')+1:offset])
+	return line, column
+}
+
+// deleteTest removes the specified test and returns false if the test was not found
+func deleteTest(name string) bool {
+	for item, value := range testNames {
+		if value == name {
+			testNames = append(testNames[:item], testNames[item+1:]...)
+			delete(testMap, name)
+			delete(testDefs, name)
+			return true
+		}
+	}
+	return false
+}
+
+// runTests executes the specified test, or all the tests (excluding the internal ones) if the name is "all",
+// skipping the tests that are not selected by the tag filter
+func runTests(name string, params map[string]string, filter *testFilter) (results []TestResult, err error) {
+	names, err := selectTests(name, filter)
+	if err != nil {
+		return nil, err
+	}
+	startTestRun()
+	defer endTestRun()
+	results = []TestResult{}
+	for _, key := range names {
+		var res []TestResult
+		res, err = runTest(key, params)
+		results = append(results, res...)
+		if err != nil {
+			// stop as soon a one test fails
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// runTest executes the specified test with the specified parameters, once for each data row (if any),
+// and returns the first error
+func runTest(name string, params map[string]string) (results []TestResult, err error) {
+	def, exist := testDefs[name]
+	if !exist {
+		return nil, fmt.Errorf("unable to find the test %s", name)
+	}
+	start := time.Now()
+	testAttempts = nil
+	testSkipped = nil
+	testParams, err = getTestParams(def.Params, params)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", name, err)
+		return []TestResult{getTestResult(name, nil, nil, start, err)}, err
+	}
+	if len(def.Data) == 0 {
+		err = execTestFile(def, nil)
+		return []TestResult{getTestResult(name, nil, nil, start, err)}, err
+	}
+	// all the rows are executed, so each failure is reported
+	for row, data := range def.Data {
+		if rerr := checkTestRun(); rerr != nil {
+			return results, fmt.Errorf("%s [row %d]: %v", name, row, rerr)
+		}
+		start = time.Now()
+		rerr := execTestFile(def, data)
+		idx := row
+		results = append(results, getTestResult(name, &idx, data, start, rerr))
+		if rerr != nil && err == nil {
+			err = fmt.Errorf("%s [row %d]: %v", name, row, rerr)
+		}
+	}
+	return results, err
+}
+
+// getTestResult returns the result of a test execution
+func getTestResult(name string, row *int, data TestRow, start time.Time, err error) TestResult {
+	res := TestResult{Test: name, Row: row, Data: data, Duration: time.Since(start).Seconds(), Attempts: testAttempts, Skipped: testSkipped}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// getTestParams returns the parameter values, applying the default values and checking the required parameters
+func getTestParams(defs TestParams, params map[string]string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	for key, def := range defs {
+		if def.Default != nil {
+			values[key] = def.Default
+		}
+	}
+	for key, value := range params {
+		values[key] = value
+	}
+	var missing []string
+	for key, def := range defs {
+		if _, ok := values[key]; def.Required && !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("missing required test parameters: %s", strings.Join(missing, ", "))
+	}
+	return values, nil
 }
 
 // execute the specified test
-func execTest(test TestEntries) (err error) {
-	var request []byte
-	var response []byte
-	var resp interface{}
-	var expresp interface{}
+func execTest(test TestEntries) error {
+	return execTestFile(TestFile{Steps: test}, nil)
+}
+
+// execTestFile executes the setup entries and the main steps of the test, and then the teardown entries,
+// where the values of the data row (if any) are the initial test variables
+func execTestFile(def TestFile, data TestRow) (err error) {
+	main := append(append(TestEntries{}, def.Setup...), def.Steps...)
 
-	testCache = make(TestEntries, len(test))
+	testCache = make(TestEntries, len(main)+len(def.Teardown))
+	testVars = make(map[string]interface{})
+	testAttempts = nil
+	testSkipped = nil
+	for key, value := range data {
+		testVars[key] = value
+	}
+	testClock = time.Now().UTC()
 
 	err = openNatsBus()
 	if err != nil {
@@ -89,50 +402,197 @@ func execTest(test TestEntries) (err error) {
 	}
 	defer closeNatsBus()
 
-	for item, msg := range test {
+	defer closeWaitSubscription()
 
-		// prepare the request
-		msg.Request, err = replaceTemplates(msg.Request)
+	for item, msg := range main {
+		err = checkTestRun()
 		if err != nil {
-			return fmt.Errorf("%s [%d]: unable to process templates on request message %v - %v", msg.Topic, item, msg.Request, err)
+			break
 		}
-
-		// save the processed message
-		testCache[item].Topic = msg.Topic
-		testCache[item].Request = msg.Request
-
-		// encode the request
-		request, err = json.Marshal(msg.Request)
+		prepareWaitFor(main, item, 0)
+		err = execTestStep(msg, item, def.Defaults)
 		if err != nil {
-			return fmt.Errorf("%s [%d]: unable to encode request message %v %v", msg.Topic, item, msg.Request, err)
+			err = getSourceError(msg, err)
+			break
 		}
+	}
+	closeWaitSubscription()
 
-		// send the request message and get the response
-		response, err = sendBusRequest(msg.Topic, request)
-		if err != nil {
-			return fmt.Errorf("%s [%d]: unable to send request message %v %v", msg.Topic, item, msg.Request, err)
+	// the teardown entries are always executed to clean up the test data, even if the test run has been cancelled,
+	// within a separate time limit
+	endTeardown := startTeardown()
+	defer endTeardown()
+	// all the teardown entries are executed, even if one of them fails
+	var terrs []string
+	for item, msg := range def.Teardown {
+		prepareWaitFor(def.Teardown, item, len(main))
+		terr := execTestStep(msg, len(main)+item, def.Defaults)
+		if terr != nil {
+			terrs = append(terrs, getSourceError(msg, terr).Error())
 		}
+	}
+	if len(terrs) == 0 {
+		return err
+	}
+	if err == nil {
+		return fmt.Errorf("teardown: %s", strings.Join(terrs, "; "))
+	}
+	return fmt.Errorf("%v; teardown: %s", err, strings.Join(terrs, "; "))
+}
+
+// getSourceError adds the location of the test entry in the original files to the error
+func getSourceError(msg TestEntry, err error) error {
+	if err == nil || msg.Source == "" {
+		return err
+	}
+	return fmt.Errorf("%v (%s)", err, msg.Source)
+}
 
-		// decode the response message
-		err = json.Unmarshal(response, &resp)
+// execTestEntry executes a single test entry and stores the processed messages in the test cache at the specified position;
+// with a retry policy the request is sent again until the response matches
+func execTestEntry(msg TestEntry, item int, defaults TestDefaults) (err error) {
+	var request []byte
+
+	if isWaitStep(msg) {
+		return execWaitStep(msg, item, defaults)
+	}
+
+	// prepare the request
+	msg.Request, err = replaceTemplates(msg.Request)
+	if err != nil {
+		return fmt.Errorf("%s [%d]: unable to process templates on request message %v - %v", msg.Topic, item, msg.Request, err)
+	}
+
+	// save the processed message
+	testCache[item].Name = msg.Name
+	testCache[item].Topic = msg.Topic
+	testCache[item].Request = msg.Request
+
+	// encode the request
+	request, err = json.Marshal(msg.Request)
+	if err != nil {
+		return fmt.Errorf("%s [%d]: unable to encode request message %v %v", msg.Topic, item, msg.Request, err)
+	}
+
+	retry := msg.Retry
+	if retry == nil {
+		retry = defaults.Retry
+	}
+	attempts := 0
+	start := time.Now()
+	for {
+		attempts++
+		err = execTestAttempt(msg, item, request, defaults)
+		delay, ok := retry.next(attempts, start)
+		if err == nil || !ok {
+			break
+		}
+		if werr := waitDelay(delay); werr != nil {
+			err = fmt.Errorf("%v; %v", err, werr)
+			break
+		}
+	}
+	if retry != nil {
+		testAttempts = append(testAttempts, StepAttempts{Step: getStepName(msg, item), Attempts: attempts})
 		if err != nil {
-			return fmt.Errorf("%s [%d]: unable to decode the response message: %v", msg.Topic, item, err)
+			return fmt.Errorf("%v (after %d attempts)", err, attempts)
 		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// store the captured variables
+	err = captureVariables(msg.Capture, item)
+	if err != nil {
+		return fmt.Errorf("%s [%d]: %v", msg.Topic, item, err)
+	}
+	return nil
+}
 
-		// save the response message value for templates
-		testCache[item].Response = resp
+// execTestAttempt sends the encoded request of the test entry and checks the response
+func execTestAttempt(msg TestEntry, item int, request []byte, defaults TestDefaults) (err error) {
+	var response []byte
+	var resp interface{}
+
+	// send the request message and get the response
+	testStepTime = time.Now().UTC()
+	response, err = sendBusRequest(msg.Topic, request, getStepTimeout(msg, defaults))
+	if err != nil {
+		return fmt.Errorf("%s [%d]: unable to send request message %v %v", msg.Topic, item, msg.Request, err)
+	}
+
+	// decode the response message
+	err = json.Unmarshal(response, &resp)
+	if err != nil {
+		return fmt.Errorf("%s [%d]: unable to decode the response message: %v", msg.Topic, item, err)
+	}
+
+	// save the response message value for templates
+	testCache[item].Response = resp
+
+	return checkResponse(msg, item, resp, defaults)
+}
 
-		// replace templates
-		expresp, err = replaceTemplates(msg.Response)
+// getStepTimeout returns the maximum time to wait for the response of the test entry
+func getStepTimeout(msg TestEntry, defaults TestDefaults) time.Duration {
+	if msg.Timeout > 0 {
+		return time.Duration(msg.Timeout) * time.Millisecond
+	}
+	if defaults.Timeout > 0 {
+		return time.Duration(defaults.Timeout) * time.Millisecond
+	}
+	return busTimeout
+}
+
+// checkResponse checks the response message against the JSON schema, the expected template and the assertions of the test entry
+func checkResponse(msg TestEntry, item int, resp interface{}, defaults TestDefaults) (err error) {
+	var expresp interface{}
+
+	// validate the response message against the JSON schema
+	if msg.Schema != "" {
+		err = validateSchema(msg.Schema, resp)
 		if err != nil {
-			return fmt.Errorf("%s [%d]: unable to process templates on response message %v - %v", msg.Topic, item, resp, err)
+			return fmt.Errorf("%s [%d]: the response message does not match the schema: %v", msg.Topic, item, err)
 		}
+	}
 
-		// compare the expected and actual messages
-		err = areMatching(expresp, resp)
-		if err != nil {
-			return fmt.Errorf("%s [%d]: the messages are different: %v", msg.Topic, item, err)
+	// replace templates
+	expresp, err = replaceTemplates(msg.Response)
+	if err != nil {
+		return fmt.Errorf("%s [%d]: unable to process templates on response message %v - %v", msg.Topic, item, resp, err)
+	}
+
+	// compare the expected and actual messages
+	err = matchMessages(expresp, resp, isStrictEntry(msg, defaults))
+	if err != nil {
+		return fmt.Errorf("%s [%d]: the messages are different: %v", msg.Topic, item, err)
+	}
+
+	// evaluate the assertions
+	err = checkAssertions(msg.Assert, item)
+	if err != nil {
+		return fmt.Errorf("%s [%d]: the assertion failed: %v", msg.Topic, item, err)
+	}
+	return nil
+}
+
+// captureVariables stores the values of the specified step in the test variables
+func captureVariables(capture map[string]string, item int) error {
+	for name, path := range capture {
+		val := getFieldValue(path, testCache[item])
+		if !val.IsValid() {
+			return fmt.Errorf("unable to capture the variable %s from %s", name, path)
 		}
+		testVars[name] = val.Interface()
 	}
 	return nil
 }
+
+// isStrictEntry returns the strict mode of the test entry, or the default one when the entry doesn't set it
+func isStrictEntry(msg TestEntry, defaults TestDefaults) bool {
+	if msg.Strict != nil {
+		return *msg.Strict
+	}
+	return defaults.Strict
+}
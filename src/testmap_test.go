@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -79,3 +81,223 @@ func TestLoadTestMapErrorA(t *testing.T) {
 func TestLoadTestMapErrorB(t *testing.T) {
 	loadTestMapErrorTesting(t, 0200)
 }
+
+func TestExecTestCapture(t *testing.T) {
+	initNatsBus("nats://127.0.0.1:4222")
+	var test TestEntries
+	err := json.Unmarshal([]byte(`[
+		{
+			"Name" : "create",
+			"Topic" : "@.capture.test",
+			"Request" : {"data" : {"id" : "A123"}},
+			"Response" : {"data" : {"id" : "~re:^A[0-9]+$"}},
+			"Capture" : {"orderId" : "Response.data.id"}
+		},
+		{
+			"Topic" : "@.capture.test",
+			"Request" : {"id" : "~var:orderId", "previous" : "~pv:create.Request.data.id"},
+			"Response" : {"id" : "A123", "previous" : "A123"}
+		}
+	]`), &test)
+	if err != nil {
+		t.Error(fmt.Errorf("Unexpected error: %v", err))
+	}
+	err = execTest(test)
+	if err != nil {
+		t.Error(fmt.Errorf("Unexpected error: %v", err))
+	}
+	if testVars["orderId"] != "A123" {
+		t.Error(fmt.Errorf("Found different value than expected: %v", testVars["orderId"]))
+	}
+
+	test[0].Capture = map[string]string{"orderId": "Response.missing"}
+	err = execTest(test)
+	if err == nil {
+		t.Error(fmt.Errorf("an error was expected"))
+	}
+}
+
+func TestRunTestParams(t *testing.T) {
+	initNatsBus("nats://127.0.0.1:4222")
+	oldTestMap, oldNames, oldDefs := testMap, testNames, testDefs
+	testMap = make(map[string]TestEntries)
+	testNames = make([]string, 0)
+	testDefs = make(map[string]TestFile)
+	defer func() {
+		testMap, testNames, testDefs = oldTestMap, oldNames, oldDefs
+		testParams = nil
+	}()
+
+	err := loadRawJSONTest([]byte(`{
+		"params" : {
+			"currency" : {"default" : "EUR"},
+			"userId" : {"required" : true}
+		},
+		"steps" : [
+			{
+				"Topic" : "@.params.test",
+				"Request" : {"user" : "~pm:userId", "currency" : "~pm:currency"},
+				"Response" : {"user" : "123", "currency" : "GBP"}
+			}
+		]
+	}`), "params")
+	if err != nil {
+		t.Error(fmt.Errorf("Unexpected error: %v", err))
+		return
+	}
+	if len(testMap["params"]) != 1 || !testDefs["params"].Params["userId"].Required {
+		t.Error(fmt.Errorf("The test file was not loaded as expected"))
+	}
+
+	_, err = runTest("params", map[string]string{"currency": "GBP"})
+	if err == nil || !strings.Contains(err.Error(), "userId") {
+		t.Error(fmt.Errorf("A missing parameter error was expected, found: %v", err))
+	}
+
+	_, err = runTest("params", map[string]string{"userId": "123"})
+	if err == nil {
+		t.Error(fmt.Errorf("A comparison error was expected with the default parameter value"))
+	}
+
+	_, err = runTest("params", map[string]string{"userId": "123", "currency": "GBP"})
+	if err != nil {
+		t.Error(fmt.Errorf("Unexpected error: %v", err))
+	}
+
+	_, err = runTest("missing", nil)
+	if err == nil {
+		t.Error(fmt.Errorf("An error was expected"))
+	}
+
+	if !deleteTest("params") || deleteTest("params") {
+		t.Error(fmt.Errorf("The test was not deleted as expected"))
+	}
+}
+
+func TestLoadRawJSONTestPosition(t *testing.T) {
+	oldTestMap, oldNames, oldDefs := testMap, testNames, testDefs
+	testMap = make(map[string]TestEntries)
+	testNames = make([]string, 0)
+	testDefs = make(map[string]TestFile)
+	defer func() {
+		testMap, testNames, testDefs = oldTestMap, oldNames, oldDefs
+	}()
+
+	tests := []struct {
+		raw      string
+		expected string
+	}{
+		{"[\n\t{\n\t\t\"Topic\" : \"a\",,\n\t}\n]", "line 3, column 17:"},
+		{"[\n  {\n    \"Topic\" : {\"a\" : 1}\n  }\n]", "line 3, column 15:"},
+		{"{\n  \"steps\" : [{\"Strict\" : \"yes\"}]\n}", "line 2, column 30:"},
+	}
+	for _, tt := range tests {
+		err := loadRawJSONTest([]byte(tt.raw), "position")
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Error(fmt.Errorf("The error should start with %q, found: %v", tt.expected, err))
+		}
+	}
+}
+
+func TestExecTestFileTeardown(t *testing.T) {
+	initNatsBus("nats://127.0.0.1:4222")
+	oldTestMap, oldNames, oldDefs := testMap, testNames, testDefs
+	testMap = make(map[string]TestEntries)
+	testNames = make([]string, 0)
+	testDefs = make(map[string]TestFile)
+	defer func() {
+		testMap, testNames, testDefs = oldTestMap, oldNames, oldDefs
+	}()
+
+	err := loadRawJSONTest([]byte(`{
+		"description" : "create and delete an order",
+		"tags" : ["orders", "smoke"],
+		"owner" : "orders-team",
+		"defaults" : {"timeout" : 500, "strict" : true},
+		"setup" : [
+			{"Name" : "login", "Topic" : "@.setup.test", "Request" : {"token" : "abc"}, "Response" : {"token" : "abc"}}
+		],
+		"steps" : [
+			{"Name" : "create", "Topic" : "@.steps.test", "Request" : {"id" : 1, "extra" : true}, "Response" : {"id" : 1}}
+		],
+		"teardown" : [
+			{"Topic" : "@.teardown.test", "Request" : {"token" : "~pv:login.Request.token"}, "Response" : {"token" : "abc"}, "Capture" : {"cleaned" : "Request.token"}}
+		]
+	}`), "rich")
+	if err != nil {
+		t.Error(fmt.Errorf("Unexpected error: %v", err))
+		return
+	}
+	def := testDefs["rich"]
+	if def.Description != "create and delete an order" || len(def.Tags) != 2 || def.Owner != "orders-team" || def.Defaults.Timeout != 500 || len(def.Setup) != 1 || len(def.Teardown) != 1 {
+		t.Error(fmt.Errorf("The test file was not loaded as expected: %#v", def))
+	}
+
+	// the strict default fails the main step, but the teardown is executed
+	_, err = runTest("rich", nil)
+	if err == nil || !strings.Contains(err.Error(), "@.steps.test [1]") {
+		t.Error(fmt.Errorf("A comparison error was expected, found: %v", err))
+	}
+	if testVars["cleaned"] != "abc" || testCache[2].Topic != "@.teardown.test" {
+		t.Error(fmt.Errorf("The teardown entries were not executed"))
+	}
+
+	def.Defaults.Strict = false
+	err = execTestFile(def, nil)
+	if err != nil {
+		t.Error(fmt.Errorf("Unexpected error: %v", err))
+	}
+
+	def.Teardown[0].Response = map[string]interface{}{"token": "xyz"}
+	err = execTestFile(def, nil)
+	if err == nil || !strings.HasPrefix(err.Error(), "teardown: @.teardown.test [2]") {
+		t.Error(fmt.Errorf("A teardown error was expected, found: %v", err))
+	}
+
+	def.Defaults.Strict = true
+	err = execTestFile(def, nil)
+	if err == nil || !strings.Contains(err.Error(), "; teardown: ") {
+		t.Error(fmt.Errorf("Both the step and the teardown errors were expected, found: %v", err))
+	}
+
+	// the following teardown entries are executed even if a teardown entry fails
+	def.Defaults.Strict = false
+	def.Teardown = append(def.Teardown,
+		TestEntry{Topic: "@.teardown.test", Request: map[string]interface{}{"id": 1}, Response: map[string]interface{}{"id": 1}, Capture: map[string]string{"deleted": "Response.id"}},
+		TestEntry{Topic: "@.teardown.test", Request: map[string]interface{}{"id": 2}, Response: map[string]interface{}{"id": 3}},
+	)
+	err = execTestFile(def, nil)
+	if err == nil || !strings.HasPrefix(err.Error(), "teardown: @.teardown.test [2]") || !strings.Contains(err.Error(), "; @.teardown.test [4]") {
+		t.Error(fmt.Errorf("All the teardown errors were expected, found: %v", err))
+	}
+	if testVars["deleted"] != float64(1) || testCache[4].Request == nil {
+		t.Error(fmt.Errorf("The teardown entries after the failed one were not executed: %v", testVars))
+	}
+}
+
+func TestIsStrictEntry(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		strict   *bool
+		defaults bool
+		expected bool
+	}{
+		{nil, false, false},
+		{nil, true, true},
+		{&enabled, false, true},
+		{&disabled, true, false},
+	}
+	for _, tt := range tests {
+		if isStrictEntry(TestEntry{Strict: tt.strict}, TestDefaults{Strict: tt.defaults}) != tt.expected {
+			t.Error(fmt.Errorf("the strict mode was expected to be %v: %v %v", tt.expected, tt.strict, tt.defaults))
+		}
+	}
+
+	// the step disables the strict default
+	var entries TestEntries
+	_ = json.Unmarshal([]byte(`[{"Topic" : "@.strict.test", "Request" : {"id" : 1, "extra" : true}, "Response" : {"id" : 1}, "Strict" : false}]`), &entries)
+	err := execTestFile(TestFile{Defaults: TestDefaults{Strict: true}, Steps: entries}, nil)
+	if err != nil {
+		t.Error(fmt.Errorf("Unexpected error: %v", err))
+	}
+}
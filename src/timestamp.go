@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timestampSeparator separates the timestamp modifiers from the time layout
+const timestampSeparator = "|"
+
+// timestampOffset matches a time offset with optional days (e.g. "+15m", "-1d12h")
+var timestampOffset = regexp.MustCompile(`^([+-])(?:([0-9]+)d)?(.*)$`)
+
+// timeMatcher matches the time matcher functions (e.g. "within(5s)" or "after(~var:start)")
+var timeMatcher = regexp.MustCompile(`^(within|after|before)\((.*)\)$`)
+
+// timestampLayouts contains the named time layouts
+var timestampLayouts = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"rfc1123":     time.RFC1123,
+}
+
+// getTimestampValue returns the timestamp specified by the template in the form "[MODIFIERS|]LAYOUT",
+// where MODIFIERS is a comma-separated list of offsets, time zones and rounding options (e.g. "+15m,tz=Europe/London|rfc3339")
+func getTimestampValue(spec string) (interface{}, error) {
+	t := testClock
+	if t.IsZero() {
+		t = time.Now().UTC()
+	}
+	layout := spec
+	if pos := strings.Index(spec, timestampSeparator); pos >= 0 {
+		layout = spec[pos+1:]
+		var err error
+		t, err = applyTimestampModifiers(t, spec[:pos])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return formatTimestamp(t, layout), nil
+}
+
+// applyTimestampModifiers applies the comma-separated list of modifiers to the time
+func applyTimestampModifiers(t time.Time, modifiers string) (time.Time, error) {
+	for _, mod := range strings.Split(modifiers, ",") {
+		mod = strings.TrimSpace(mod)
+		switch {
+		case mod == "":
+			continue
+		case mod == "live":
+			// use the wall clock instead of the frozen test clock
+			t = time.Now().In(t.Location())
+		case mod == "startofday":
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		case mod == "endofday":
+			t = time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 59, 999999999, t.Location())
+		case strings.HasPrefix(mod, "tz="):
+			loc, err := time.LoadLocation(mod[3:])
+			if err != nil {
+				return t, fmt.Errorf("invalid time zone: %s", mod[3:])
+			}
+			t = t.In(loc)
+		case mod[0] == '+' || mod[0] == '-':
+			offset, err := parseTimestampOffset(mod)
+			if err != nil {
+				return t, err
+			}
+			t = t.Add(offset)
+		default:
+			return t, fmt.Errorf("invalid timestamp modifier: %s", mod)
+		}
+	}
+	return t, nil
+}
+
+// parseTimestampOffset parses a time offset in the Go duration format with the optional number of days (e.g. "+1d2h30m")
+func parseTimestampOffset(offset string) (time.Duration, error) {
+	match := timestampOffset.FindStringSubmatch(offset)
+	if match == nil || (match[2] == "" && match[3] == "") {
+		return 0, fmt.Errorf("invalid time offset: %s", offset)
+	}
+	var dur time.Duration
+	if match[2] != "" {
+		days, err := strconv.Atoi(match[2])
+		if err != nil {
+			return 0, fmt.Errorf("invalid time offset: %s", offset)
+		}
+		dur = time.Duration(days) * 24 * time.Hour
+	}
+	if match[3] != "" {
+		d, err := time.ParseDuration(match[3])
+		if err != nil || d < 0 {
+			return 0, fmt.Errorf("invalid time offset: %s", offset)
+		}
+		dur += d
+	}
+	if match[1] == "-" {
+		dur = -dur
+	}
+	return dur, nil
+}
+
+// formatTimestamp formats the time using the specified layout; the empty layout returns the Unix time in seconds
+func formatTimestamp(t time.Time, layout string) interface{} {
+	switch layout {
+	case "", "unix":
+		return t.Unix()
+	case "unixms":
+		return t.UnixNano() / int64(time.Millisecond)
+	case "unixns":
+		return t.UnixNano()
+	}
+	if named, ok := timestampLayouts[layout]; ok {
+		layout = named
+	}
+	return t.Format(layout)
+}
+
+// processCompareTime checks the actual time against the time window defined by the matcher ("~tm:"):
+// "within(DURATION[,REFERENCE])", "after(REFERENCE)" or "before(REFERENCE)".
+// The default reference is the time when the request of the current step was sent.
+func processCompareTime(arg string, actual interface{}) error {
+	value := "~tm:" + arg
+	match := timeMatcher.FindStringSubmatch(arg)
+	if match == nil {
+		return fmt.Errorf("invalid time matcher: %s", value)
+	}
+	act, err := getTimeValue(actual)
+	if err != nil {
+		return getFormattedDiffError(err.Error(), value, actual)
+	}
+	ref := match[2]
+	var window time.Duration
+	if match[1] == "within" {
+		args := strings.SplitN(ref, ",", 2)
+		window, err = time.ParseDuration(strings.TrimSpace(args[0]))
+		if err != nil || window < 0 {
+			return fmt.Errorf("invalid time window: %s", value)
+		}
+		ref = ""
+		if len(args) == 2 {
+			ref = args[1]
+		}
+	}
+	reftime, err := getTimeReference(strings.TrimSpace(ref))
+	if err != nil {
+		return fmt.Errorf("invalid time reference: %s -- [%v]", value, err)
+	}
+	var ok bool
+	switch match[1] {
+	case "within":
+		diff := act.Sub(reftime)
+		ok = (diff <= window) && (diff >= -window)
+	case "after":
+		ok = act.After(reftime)
+	case "before":
+		ok = act.Before(reftime)
+	}
+	if !ok {
+		return getFormattedDiffError(fmt.Sprintf("the time is not %s %s", match[1], reftime.Format(time.RFC3339Nano)), value, actual)
+	}
+	return nil
+}
+
+// getTimeReference returns the reference time of a time matcher: the step time, the step time plus an offset (e.g. "-1m"),
+// a template value (e.g. "~var:start") or a time value
+func getTimeReference(ref string) (time.Time, error) {
+	stepTime := testStepTime
+	if stepTime.IsZero() {
+		stepTime = time.Now().UTC()
+	}
+	if ref == "" {
+		return stepTime, nil
+	}
+	if newval, ok := getTemplateValue(ref); ok {
+		return getTimeValue(newval)
+	}
+	if ref[0] == '+' || ref[0] == '-' {
+		if offset, err := parseTimestampOffset(ref); err == nil {
+			return stepTime.Add(offset), nil
+		}
+	}
+	return getTimeValue(ref)
+}
+
+// getTimeValue parses a time in RFC3339 format or a Unix time in seconds, milliseconds, microseconds or nanoseconds
+func getTimeValue(value interface{}) (time.Time, error) {
+	var num float64
+	switch val := value.(type) {
+	case time.Time:
+		return val, nil
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, val)
+		if err == nil {
+			return t, nil
+		}
+		num, err = strconv.ParseFloat(val, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("the value is not a valid time: %s", val)
+		}
+	default:
+		var err error
+		num, err = getTransfNumber(value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("the value is not a valid time: %v", value)
+		}
+	}
+	// guess the Unix time unit from the magnitude of the number
+	abs := math.Abs(num)
+	switch {
+	case abs < 1e11:
+		return time.Unix(0, int64(num*1e9)).UTC(), nil
+	case abs < 1e14:
+		return time.Unix(0, int64(num*1e6)).UTC(), nil
+	case abs < 1e17:
+		return time.Unix(0, int64(num*1e3)).UTC(), nil
+	}
+	return time.Unix(0, int64(num)).UTC(), nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var timestampCases = []struct {
+	spec     string
+	expected interface{}
+}{
+	{"", int64(1700000000)},
+	{"unix", int64(1700000000)},
+	{"unixms", int64(1700000000000)},
+	{"unixns", int64(1700000000000000000)},
+	{"15:04:05", "22:13:20"},
+	{"rfc3339", "2023-11-14T22:13:20Z"},
+	{"+15m|rfc3339", "2023-11-14T22:28:20Z"},
+	{"-1d2h|rfc3339", "2023-11-13T20:13:20Z"},
+	{"+1d,-30s|2006-01-02 15:04:05", "2023-11-15 22:12:50"},
+	{"tz=Europe/London,startofday|unixms", int64(1699920000000)},
+	{"tz=America/New_York,startofday|rfc3339", "2023-11-14T00:00:00-05:00"},
+	{"endofday|rfc3339nano", "2023-11-14T23:59:59.999999999Z"},
+	{"tz=Asia/Tokyo|2006-01-02", "2023-11-15"},
+}
+
+func TestGetTimestampValue(t *testing.T) {
+	testClock = time.Unix(1700000000, 0).UTC()
+	defer func() { testClock = time.Time{} }()
+	for _, tt := range timestampCases {
+		val, err := getTimestampValue(tt.spec)
+		if err != nil {
+			t.Error(fmt.Errorf("%s: an error was not expected: %v", tt.spec, err))
+			continue
+		}
+		if val != tt.expected {
+			t.Error(fmt.Errorf("%s: expected %#v, found %#v", tt.spec, tt.expected, val))
+		}
+	}
+}
+
+func TestGetTimestampValueLive(t *testing.T) {
+	testClock = time.Unix(1700000000, 0).UTC()
+	defer func() { testClock = time.Time{} }()
+	val, err := getTimestampValue("live|unix")
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	if val.(int64) < time.Now().Unix()-10 {
+		t.Error(fmt.Errorf("the wall clock time was expected, found: %v", val))
+	}
+}
+
+var timestampErrorCases = []string{
+	"tz=Invalid/Zone|unix",
+	"+|unix",
+	"+5x|unix",
+	"+1d-5m|unix",
+	"tomorrow|unix",
+}
+
+func TestGetTimestampValueErrors(t *testing.T) {
+	for _, spec := range timestampErrorCases {
+		_, err := getTimestampValue(spec)
+		if err == nil {
+			t.Error(fmt.Errorf("%s: an error was expected", spec))
+		}
+	}
+}
+
+var timeMatcherCases = []struct {
+	expected string
+	actual   interface{}
+	match    bool
+}{
+	{"~tm:within(5s)", "2023-11-14T22:13:22Z", true},
+	{"~tm:within(5s)", "2023-11-14T22:13:30Z", false},
+	{"~tm:within(5s)", "2023-11-14T23:13:18+01:00", true},
+	{"~tm:within(5s)", float64(1700000003), true},
+	{"~tm:within(5s)", float64(1700000003500), true},
+	{"~tm:within(5s)", float64(1699999990000000), false},
+	{"~tm:within(5s)", "1700000001", true},
+	{"~tm:within(1m, ~var:start)", "2023-11-14T22:00:30Z", true},
+	{"~tm:within(1m,-1h)", "2023-11-14T21:13:20Z", true},
+	{"~tm:after(~var:start)", "2023-11-14T22:00:01Z", true},
+	{"~tm:after(~var:start)", "2023-11-14T21:59:59Z", false},
+	{"~tm:before(+1m)", "2023-11-14T22:14:00Z", true},
+	{"~tm:before(+1m)", "2023-11-14T22:15:00Z", false},
+	{"~tm:after(2023-01-01T00:00:00Z)", float64(1700000000), true},
+	{"~tm:after(~ts:-1d|rfc3339)", "2023-11-14T00:00:00Z", true},
+	{"~tm:within(5s)", "yesterday", false},
+	{"~tm:within(5s)", true, false},
+	{"~not:~tm:within(5s)", "2023-11-14T22:13:30Z", true},
+}
+
+func TestTimeMatcher(t *testing.T) {
+	testClock = time.Unix(1700000000, 0).UTC()
+	testStepTime = testClock
+	testVars = map[string]interface{}{"start": "2023-11-14T22:00:00Z"}
+	defer func() {
+		testClock = time.Time{}
+		testStepTime = time.Time{}
+		testVars = nil
+	}()
+	for _, tt := range timeMatcherCases {
+		err := areMatching(map[string]interface{}{"t": tt.expected}, map[string]interface{}{"t": tt.actual})
+		if tt.match && err != nil {
+			t.Error(fmt.Errorf("%s %v: an error was not expected: %v", tt.expected, tt.actual, err))
+		}
+		if !tt.match && err == nil {
+			t.Error(fmt.Errorf("%s %v: an error was expected", tt.expected, tt.actual))
+		}
+	}
+}
+
+var timeMatcherErrorCases = []string{
+	"~tm:around(5s)",
+	"~tm:within(5x)",
+	"~tm:within(-5s)",
+	"~tm:after(tomorrow)",
+}
+
+func TestTimeMatcherErrors(t *testing.T) {
+	for _, expected := range timeMatcherErrorCases {
+		err := areMatching(expected, "2023-11-14T22:13:20Z")
+		if err == nil {
+			t.Error(fmt.Errorf("%s: an error was expected", expected))
+		}
+	}
+}
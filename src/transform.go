@@ -0,0 +1,284 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/md5"  // #nosec
+	"crypto/sha1" // #nosec
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// init registers the built-in transformation functions
+func init() {
+	mustRegisterTransformer("base64enc", transfBase64Encode)
+	mustRegisterTransformer("base64dec", transfBase64Decode)
+	mustRegisterTransformer("base64urlenc", transfBase64URLEncode)
+	mustRegisterTransformer("base64urldec", transfBase64URLDecode)
+	mustRegisterTransformer("hexenc", transfHexEncode)
+	mustRegisterTransformer("hexdec", transfHexDecode)
+	mustRegisterTransformer("md5", transfHash(md5.New))
+	mustRegisterTransformer("sha1", transfHash(sha1.New))
+	mustRegisterTransformer("sha256", transfHash(sha256.New))
+	mustRegisterTransformer("sha512", transfHash(sha512.New))
+	mustRegisterTransformer("hmac", transfHmac)
+	mustRegisterTransformer("urlenc", transfURLEncode)
+	mustRegisterTransformer("urldec", transfURLDecode)
+	mustRegisterTransformer("upper", transfUpper)
+	mustRegisterTransformer("lower", transfLower)
+	mustRegisterTransformer("trim", transfTrim)
+	mustRegisterTransformer("substr", transfSubstr)
+	mustRegisterTransformer("jsonenc", transfJSONEncode)
+	mustRegisterTransformer("jsondec", transfJSONDecode)
+	mustRegisterTransformer("jsonpath", transfJSONPath)
+	mustRegisterTransformer("num", transfNumber)
+	mustRegisterTransformer("format", transfFormat)
+	mustRegisterTransformer("jwtsign", transfJWTSign)
+	mustRegisterTransformer("jwtdecode", transfJWTDecode)
+}
+
+// hashFuncs is the map of the hash functions supported by the HMAC transformation
+var hashFuncs = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// execTransfChain executes the sequence of transformations separated by the ">" character.
+// Each transformation is either a registered transformer (e.g. "substr:0:8") or an external command.
+func execTransfChain(chain string, value reflect.Value) (reflect.Value, error) {
+	var err error
+	for _, transf := range strings.Split(chain, ">") {
+		if t, args, ok := getTransformer(transf); ok {
+			var newval interface{}
+			newval, err = t.Transform(value.Interface(), args)
+			if err != nil {
+				return value, fmt.Errorf("unable to execute the transformation: %v -- [%v]", transf, err)
+			}
+			value = reflect.ValueOf(newval)
+			if !value.IsValid() {
+				return value, nil
+			}
+			continue
+		}
+		value, err = execTransfCmd(transf, value)
+		if err != nil {
+			return value, err
+		}
+	}
+	return value, nil
+}
+
+// getTransfString returns the value as string, JSON-encoding any non-string value
+func getTransfString(value interface{}) (string, error) {
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	jsonval, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("unable to json-encode the value: %#v -- [%v]", value, err)
+	}
+	return string(jsonval), nil
+}
+
+// getTransfNumber returns the value as a float64 number
+func getTransfNumber(value interface{}) (float64, error) {
+	switch num := value.(type) {
+	case float64:
+		return num, nil
+	case int:
+		return float64(num), nil
+	case int32:
+		return float64(num), nil
+	case int64:
+		return float64(num), nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(num), 64)
+	}
+	return 0, fmt.Errorf("the value is not a number: %#v", value)
+}
+
+// transfStringFunc converts a string function into a transformation function
+func transfStringFunc(fn func(string) (string, error)) TransformerFunc {
+	return func(value interface{}, args []string) (interface{}, error) {
+		str, err := getTransfString(value)
+		if err != nil {
+			return nil, err
+		}
+		return fn(str)
+	}
+}
+
+// transfBase64Encode encodes the value in standard base64
+var transfBase64Encode = transfStringFunc(func(str string) (string, error) {
+	return base64.StdEncoding.EncodeToString([]byte(str)), nil
+})
+
+// transfBase64Decode decodes a standard base64 value
+var transfBase64Decode = transfStringFunc(func(str string) (string, error) {
+	out, err := base64.StdEncoding.DecodeString(str)
+	return string(out), err
+})
+
+// transfBase64URLEncode encodes the value in URL-safe base64 without padding
+var transfBase64URLEncode = transfStringFunc(func(str string) (string, error) {
+	return base64.RawURLEncoding.EncodeToString([]byte(str)), nil
+})
+
+// transfBase64URLDecode decodes a URL-safe base64 value with or without padding
+var transfBase64URLDecode = transfStringFunc(func(str string) (string, error) {
+	out, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(str, "="))
+	return string(out), err
+})
+
+// transfHexEncode encodes the value in hexadecimal
+var transfHexEncode = transfStringFunc(func(str string) (string, error) {
+	return hex.EncodeToString([]byte(str)), nil
+})
+
+// transfHexDecode decodes an hexadecimal value
+var transfHexDecode = transfStringFunc(func(str string) (string, error) {
+	out, err := hex.DecodeString(str)
+	return string(out), err
+})
+
+// transfURLEncode escapes the value to be used in a URL query
+var transfURLEncode = transfStringFunc(func(str string) (string, error) {
+	return url.QueryEscape(str), nil
+})
+
+// transfURLDecode unescapes an URL query value
+var transfURLDecode = transfStringFunc(url.QueryUnescape)
+
+// transfUpper converts the value to upper case
+var transfUpper = transfStringFunc(func(str string) (string, error) {
+	return strings.ToUpper(str), nil
+})
+
+// transfLower converts the value to lower case
+var transfLower = transfStringFunc(func(str string) (string, error) {
+	return strings.ToLower(str), nil
+})
+
+// transfTrim removes the leading and trailing white spaces
+var transfTrim = transfStringFunc(func(str string) (string, error) {
+	return strings.TrimSpace(str), nil
+})
+
+// transfJSONEncode encodes the value as JSON string
+func transfJSONEncode(value interface{}, args []string) (interface{}, error) {
+	out, err := json.Marshal(value)
+	return string(out), err
+}
+
+// transfHash returns a transformation function that returns the hexadecimal hash of the value
+func transfHash(fn func() hash.Hash) TransformerFunc {
+	return transfStringFunc(func(str string) (string, error) {
+		h := fn()
+		_, err := h.Write([]byte(str))
+		return hex.EncodeToString(h.Sum(nil)), err
+	})
+}
+
+// transfHmac returns the hexadecimal HMAC of the value (e.g. "hmac:sha256:secret")
+func transfHmac(value interface{}, args []string) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("the hmac transformation requires the hash function and the key")
+	}
+	fn, ok := hashFuncs[args[0]]
+	if !ok {
+		return nil, fmt.Errorf("invalid hash function: %s", args[0])
+	}
+	str, err := getTransfString(value)
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(fn, []byte(strings.Join(args[1:], ":")))
+	_, err = h.Write([]byte(str))
+	return hex.EncodeToString(h.Sum(nil)), err
+}
+
+// transfSubstr returns the portion of the value between the start and the optional end character positions (e.g. "substr:0:8")
+func transfSubstr(value interface{}, args []string) (interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("the substr transformation requires the start and optionally the end position")
+	}
+	str, err := getTransfString(value)
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(str)
+	pos := []int{0, len(runes)}
+	for i, arg := range args {
+		pos[i], err = strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid substr position: %s", arg)
+		}
+		if pos[i] < 0 {
+			// negative positions are counted from the end
+			pos[i] += len(runes)
+		}
+		if pos[i] < 0 || pos[i] > len(runes) {
+			return nil, fmt.Errorf("the substr position is out of range: %s", arg)
+		}
+	}
+	if pos[0] > pos[1] {
+		return nil, fmt.Errorf("the substr start position is after the end position")
+	}
+	return string(runes[pos[0]:pos[1]]), nil
+}
+
+// transfJSONDecode decodes a JSON string
+func transfJSONDecode(value interface{}, args []string) (interface{}, error) {
+	str, ok := value.(string)
+	if !ok {
+		// the value is already decoded
+		return value, nil
+	}
+	var out interface{}
+	err := json.Unmarshal([]byte(str), &out)
+	return out, err
+}
+
+// transfJSONPath extracts the value at the specified path (e.g. "jsonpath:data.items.0.id"); string values are JSON-decoded first
+func transfJSONPath(value interface{}, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("the jsonpath transformation requires the path")
+	}
+	data, err := transfJSONDecode(value, nil)
+	if err != nil {
+		return nil, err
+	}
+	return getValidInterface(getFieldValue(args[0], data)), nil
+}
+
+// transfNumber converts the value into a number
+func transfNumber(value interface{}, args []string) (interface{}, error) {
+	return getTransfNumber(value)
+}
+
+// transfFormat formats a number using the specified fmt verb (e.g. "format:%.2f" or "format:%05d")
+func transfFormat(value interface{}, args []string) (interface{}, error) {
+	if len(args) != 1 || !strings.HasPrefix(args[0], "%") {
+		return nil, fmt.Errorf("the format transformation requires a format verb")
+	}
+	num, err := getTransfNumber(value)
+	if err != nil {
+		return nil, err
+	}
+	verb, _ := utf8.DecodeLastRuneInString(args[0])
+	if strings.ContainsRune("bdoxX", verb) {
+		return fmt.Sprintf(args[0], int64(num)), nil
+	}
+	return fmt.Sprintf(args[0], num), nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var transfChainCases = []struct {
+	chain    string
+	value    interface{}
+	expected interface{}
+}{
+	{"base64enc", "hello", "aGVsbG8="},
+	{"base64dec", "aGVsbG8=", "hello"},
+	{"base64urlenc", "?>?", "Pz4_"},
+	{"base64urldec", "Pz4_", "?>?"},
+	{"hexenc", "hi", "6869"},
+	{"hexdec", "6869", "hi"},
+	{"md5", "hello", "5d41402abc4b2a76b9719d911017c592"},
+	{"sha1", "hello", "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+	{"sha256", "hello", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+	{"hmac:sha256:key", "hello", "9307b3b915efb5171ff14d8cb55fbcc798c6c0ef1456d66ded1a6aa723a58b7b"},
+	{"urlenc", "a b&c", "a+b%26c"},
+	{"urldec", "a+b%26c", "a b&c"},
+	{"upper", "Hello", "HELLO"},
+	{"lower", "Hello", "hello"},
+	{"trim", " hello ", "hello"},
+	{"substr:1:3", "hello", "el"},
+	{"substr:-3", "hello", "llo"},
+	{"jsonenc", map[string]interface{}{"a": 1}, `{"a":1}`},
+	{"jsondec", `{"a":1}`, map[string]interface{}{"a": float64(1)}},
+	{"jsonpath:data.items.1", `{"data":{"items":["x","y"]}}`, "y"},
+	{"jsonpath:data.id", map[string]interface{}{"data": map[string]interface{}{"id": "A1"}}, "A1"},
+	{"num", "12.5", float64(12.5)},
+	{"format:%.2f", float64(3.14159), "3.14"},
+	{"format:%05d", "42", "00042"},
+	{"upper>base64enc", "hello", "SEVMTE8="},
+	{"md5>substr:0:8>upper", "hello", "5D41402A"},
+	{"lower>/bin/echo -n %v", "HELLO", "hello"},
+}
+
+func TestExecTransfChain(t *testing.T) {
+	for _, tt := range transfChainCases {
+		val, err := execTransfChain(tt.chain, reflect.ValueOf(tt.value))
+		if err != nil {
+			t.Error(fmt.Errorf("%s: an error was not expected: %v", tt.chain, err))
+			continue
+		}
+		if !reflect.DeepEqual(val.Interface(), tt.expected) {
+			t.Error(fmt.Errorf("%s: expected %#v, found %#v", tt.chain, tt.expected, val.Interface()))
+		}
+	}
+}
+
+var transfChainErrorCases = []struct {
+	chain string
+	value interface{}
+}{
+	{"base64dec", "%%%"},
+	{"hexdec", "xyz"},
+	{"hmac:sha256", "hello"},
+	{"hmac:sha3:key", "hello"},
+	{"substr", "hello"},
+	{"substr:a", "hello"},
+	{"substr:9", "hello"},
+	{"substr:3:1", "hello"},
+	{"jsondec", "{"},
+	{"jsonpath", "{}"},
+	{"num", "abc"},
+	{"num", true},
+	{"format:.2f", float64(1)},
+	{"upper>/invalid/cmd %v", "hello"},
+}
+
+func TestExecTransfChainErrors(t *testing.T) {
+	for _, tt := range transfChainErrorCases {
+		_, err := execTransfChain(tt.chain, reflect.ValueOf(tt.value))
+		if err == nil {
+			t.Error(fmt.Errorf("%s: an error was expected", tt.chain))
+		}
+	}
+}
+
+func TestGetFieldValueTransfChain(t *testing.T) {
+	val := getFieldValue("0.Request.name>upper>substr:0:4", testMap["@internal"])
+	if val.Interface().(string) != "SOME" {
+		t.Error(fmt.Errorf("Found different value than expected: %#v", val))
+	}
+}
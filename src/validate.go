@@ -0,0 +1,499 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// ValidationProblem describes a problem found in a test or fragment file
+type ValidationProblem struct {
+	Location string `json:"location"` // file and position (e.g. "test_orders.json:3:5") or path of the invalid value (e.g. "test_orders.json:steps[1].Request.id")
+	Message  string `json:"message"`  // description of the problem
+}
+
+// ValidationReport contains the problems found in a test or fragment file
+type ValidationReport struct {
+	File     string              `json:"file"`     // file name
+	Problems []ValidationProblem `json:"problems"` // list of problems (empty if the file is valid)
+}
+
+// templatePrefix matches the template and matcher prefixes (e.g. "~pv:" or "~present")
+var templatePrefix = regexp.MustCompile(`^~([a-zA-Z][a-zA-Z0-9_]*)(:|$)`)
+
+// markerNames contains the names of the markers that can be used without arguments in the expected response
+var markerNames = map[string]bool{"strict": true, "unordered": true, "contains": true, "absent": true, "present": true, "null": true}
+
+// templateLinter checks the templates of a list of test entries
+type templateLinter struct {
+	entries   TestEntries // test entries in the order of execution
+	item      int         // position of the current entry
+	checkRefs bool        // if true the "~pv:" step references are resolved (false for the fragment files)
+	params    TestParams  // parameters of the fragment, referenced as "~arg:NAME" (nil for the test files)
+	problems  []ValidationProblem
+}
+
+// validateTestFiles validates all the fragment files and the specified test files (or all of them if the name is "all")
+// in the configuration directories, without executing the tests
+func validateTestFiles(names []string) ([]ValidationReport, error) {
+	files := findTestFiles("test_")
+	for _, name := range names {
+		found := name == "all"
+		for _, file := range files {
+			found = found || file.name == name
+		}
+		if !found {
+			return nil, fmt.Errorf("unable to find the test %s", name)
+		}
+	}
+
+	reports, fragments, err := validateFragmentFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if !isSelectedName(file.name, names) {
+			continue
+		}
+		raw, err := ioutil.ReadFile(file.path) // #nosec
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the configuration file: %v", err)
+		}
+		reports = append(reports, newValidationReport(file.path, validateRawTest(raw, filepath.Base(file.path), fragments)))
+	}
+	return reports, nil
+}
+
+// validateFragmentFiles validates the fragment files in the configuration directories, and returns their reports
+// and a separate registry with the valid fragments, to leave the loaded tests untouched
+func validateFragmentFiles() ([]ValidationReport, map[string]TestFragment, error) {
+	reports := []ValidationReport{}
+	fragments := make(map[string]TestFragment)
+	for _, file := range findTestFiles("fragment_") {
+		raw, err := ioutil.ReadFile(file.path) // #nosec
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to read the configuration file: %v", err)
+		}
+		source := filepath.Base(file.path)
+		problems := validateRawFragment(raw, source)
+		if len(problems) == 0 {
+			_ = loadRawFragment(raw, file.name, source, fragments)
+		}
+		reports = append(reports, newValidationReport(file.path, problems))
+	}
+	return reports, fragments, nil
+}
+
+// newValidationReport returns the report of a file, with an empty list if there are no problems
+func newValidationReport(file string, problems []ValidationProblem) ValidationReport {
+	if problems == nil {
+		problems = []ValidationProblem{}
+	}
+	return ValidationReport{File: file, Problems: problems}
+}
+
+// isSelectedName returns true if the test name is in the list, or if the list contains "all"
+func isSelectedName(name string, names []string) bool {
+	for _, item := range names {
+		if item == name || (item == "all" && !strings.HasPrefix(name, "@")) {
+			return true
+		}
+	}
+	return false
+}
+
+// countProblems returns the total number of problems in the reports
+func countProblems(reports []ValidationReport) int {
+	count := 0
+	for _, report := range reports {
+		count += len(report.Problems)
+	}
+	return count
+}
+
+// validateRawTest validates a JSON or YAML test (depending on the source file extension) against the test schema,
+// and checks the options and the templates of the entries, including the ones of the fragments included from the registry
+func validateRawTest(raw []byte, source string, fragments map[string]TestFragment) []ValidationProblem {
+	problems := validateRawSchema(raw, source, "")
+	testData, err := decodeRawTest(raw, source)
+	if err != nil {
+		if len(problems) > 0 {
+			return problems
+		}
+		return append(problems, getValidationProblem(source, err))
+	}
+	if testData.Defaults.Retry != nil {
+		if err = testData.Defaults.Retry.check(); err != nil {
+			problems = append(problems, ValidationProblem{Location: source + ":defaults.retry", Message: err.Error()})
+		}
+	}
+	if _, err = loadTestData(testData); err != nil {
+		problems = append(problems, ValidationProblem{Location: source + ":dataFile", Message: err.Error()})
+	}
+	testData, err = expandTestFile(testData, source, fragments)
+	if err != nil {
+		return append(problems, ValidationProblem{Location: source, Message: err.Error()})
+	}
+	entries := append(append(append(TestEntries{}, testData.Setup...), testData.Steps...), testData.Teardown...)
+	return append(problems, lintEntries(entries, source, true, nil)...)
+}
+
+// validateRawFragment validates a JSON or YAML fragment file against the fragment schema and checks its entries;
+// the "~pv:" step references are not resolved, since they depend on the including tests
+func validateRawFragment(raw []byte, source string) []ValidationProblem {
+	problems := validateRawSchema(raw, source, "#/definitions/fragment")
+	data, err := decodeRawTest(raw, source)
+	if err != nil {
+		if len(problems) > 0 {
+			return problems
+		}
+		return append(problems, getValidationProblem(source, err))
+	}
+	return append(problems, lintEntries(data.Steps, source+":steps", false, data.Params)...)
+}
+
+// validateRawSchema validates the JSON or YAML document against the test schema (or against the specified definition)
+func validateRawSchema(raw []byte, source string, definition string) []ValidationProblem {
+	data := raw
+	switch filepath.Ext(source) {
+	case ".yaml", ".yml":
+		var err error
+		data, _, err = yamlToJSON(raw)
+		if err != nil {
+			return []ValidationProblem{getValidationProblem(source, err)}
+		}
+	}
+	var doc interface{}
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		return []ValidationProblem{getValidationProblem(source, getJSONPositionError(data, err))}
+	}
+	path, err := findConfigFile(TestSchemaFile)
+	if err != nil {
+		return []ValidationProblem{{Location: source, Message: err.Error()}}
+	}
+	schema, err := jsonschema.NewCompiler().Compile(path + definition)
+	if err != nil {
+		return []ValidationProblem{{Location: source, Message: fmt.Sprintf("unable to load the JSON schema %s: %v", TestSchemaFile, err)}}
+	}
+	err = schema.Validate(doc)
+	if err == nil {
+		return nil
+	}
+	verr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return []ValidationProblem{{Location: source, Message: err.Error()}}
+	}
+	var problems []ValidationProblem
+	for _, leaf := range getSchemaErrorLeaves(verr) {
+		problems = append(problems, ValidationProblem{Location: source + ":" + getPointerPath(leaf.InstanceLocation), Message: leaf.Message})
+	}
+	return problems
+}
+
+// getValidationProblem returns the problem of a decoding error, with the line and column when available
+func getValidationProblem(source string, err error) ValidationProblem {
+	if perr, ok := err.(*positionError); ok {
+		return ValidationProblem{Location: fmt.Sprintf("%s:%d:%d", source, perr.Line, perr.Column), Message: perr.Err.Error()}
+	}
+	return ValidationProblem{Location: source, Message: err.Error()}
+}
+
+// getPointerPath converts a JSON pointer (e.g. "/steps/1/Topic") into the path used in the locations (e.g. "steps[1].Topic")
+func getPointerPath(pointer string) string {
+	var path string
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		if _, err := strconv.Atoi(token); err == nil {
+			path += "[" + token + "]"
+			continue
+		}
+		if path != "" {
+			path += "."
+		}
+		path += token
+	}
+	return path
+}
+
+// lintEntries checks the options and the templates of the test entries, where the location is used for the entries
+// without source (e.g. "fragment_login.json:steps") and the params are the fragment parameters (nil for the test files)
+func lintEntries(entries TestEntries, location string, checkRefs bool, params TestParams) []ValidationProblem {
+	l := &templateLinter{entries: entries, checkRefs: checkRefs, params: params}
+	for item, msg := range entries {
+		l.item = item
+		loc := msg.Source
+		if loc == "" {
+			loc = fmt.Sprintf("%s[%d]", location, item)
+		}
+		if msg.Topic == "" && msg.Include == "" && !isWaitStep(msg) {
+			l.add(loc, "the entry requires a Topic, an Include or a wait option")
+		}
+		if msg.Retry != nil {
+			if err := msg.Retry.check(); err != nil {
+				l.add(loc+".Retry", err.Error())
+			}
+		}
+		if err := checkFlowControl(msg); err != nil {
+			l.add(loc, err.Error())
+		}
+		l.lintValue(msg.Request, loc+".Request", false)
+		l.lintValue(msg.Response, loc+".Response", true)
+		l.lintValue(msg.ForEach, loc+".ForEach", false)
+		l.lintValue(msg.WaitUntil, loc+".WaitUntil", false)
+		l.lintValue(msg.WaitFor, loc+".WaitFor", false)
+		for name, value := range msg.With {
+			l.lintValue(value, loc+".With."+name, false)
+		}
+		l.lintAssertions(msg.Assert, loc+".Assert")
+		for name, path := range msg.Capture {
+			l.lintCapture(path, loc+".Capture."+name)
+		}
+		l.lintSchema(msg.Schema, loc+".Schema")
+	}
+	return l.problems
+}
+
+// add appends a problem to the list
+func (l *templateLinter) add(location, message string) {
+	l.problems = append(l.problems, ValidationProblem{Location: location, Message: message})
+}
+
+// lintValue recursively checks the templates contained in the value,
+// where the expected response values can also contain matchers and markers
+func (l *templateLinter) lintValue(value interface{}, path string, response bool) {
+	switch val := value.(type) {
+	case map[string]interface{}:
+		for key, item := range val {
+			l.lintValue(item, path+"."+key, response)
+		}
+	case []interface{}:
+		for i, item := range val {
+			l.lintValue(item, fmt.Sprintf("%s[%d]", path, i), response)
+		}
+	case string:
+		l.lintString(val, path, response)
+	}
+}
+
+// lintString checks a single template, matcher or marker
+func (l *templateLinter) lintString(value string, path string, response bool) {
+	match := templatePrefix.FindStringSubmatch(value)
+	if match == nil {
+		// not a template
+		return
+	}
+	name, hasArg, arg := match[1], match[2] == ":", value[len(match[0]):]
+	switch {
+	case name == "pv":
+		l.lintPath(arg, path, response, true)
+	case name == "var" || name == "pm":
+		l.lintPath(arg, path, response, false)
+	case name == "arg" && hasArg:
+		l.lintFragmentArg(arg, path)
+	case hasArg && (name == "ts" || name == "rd" || name == "tp" || name == "jw" || name == "env"):
+		l.lintTemplateSpec(name, arg, path)
+	case templateProviders[name] != nil || !hasArg:
+		// the values without arguments are simple strings, unless they are markers or matchers
+		return
+	case !response:
+		l.add(path, fmt.Sprintf("unknown template prefix: ~%s:", name))
+	case name == "not":
+		l.lintString(arg, path, response)
+	case name == "xc":
+		l.lintCommand(strings.SplitN(arg, ":", 2)[0], path)
+	default:
+		if _, ok := matchers[name]; !ok && !markerNames[name] {
+			l.add(path, fmt.Sprintf("unknown template prefix or matcher: ~%s:", name))
+		} else if ok && arg == "" {
+			l.add(path, fmt.Sprintf("missing argument of the matcher ~%s:", name))
+		}
+	}
+}
+
+// lintTemplateSpec checks the specification of the built-in templates with the same parsers used at run time
+func (l *templateLinter) lintTemplateSpec(name string, arg string, path string) {
+	var err error
+	switch name {
+	case "ts":
+		if pos := strings.Index(arg, timestampSeparator); pos >= 0 {
+			_, err = applyTimestampModifiers(time.Now(), arg[:pos])
+		}
+	case "rd":
+		if match := randomVarName.FindStringSubmatch(arg); match != nil {
+			arg = arg[:len(arg)-len(match[0])]
+		}
+		_, err = parseRandomSpec(arg)
+	case "tp":
+		_, err = template.New("value").Funcs(getGoTemplateFuncs()).Parse(arg)
+	case "jw":
+		l.lintJWTSpec(arg, path)
+	case "env":
+		if arg == "" {
+			err = fmt.Errorf("missing environment variable name")
+		}
+	}
+	if err != nil {
+		l.add(path, fmt.Sprintf("invalid ~%s: template: %v", name, err))
+	}
+}
+
+// lintJWTSpec checks the key name and the claims of the "~jw:" template, including the templates of the claims
+func (l *templateLinter) lintJWTSpec(arg string, path string) {
+	parts := strings.SplitN(arg, ":", 2)
+	if len(parts) != 2 {
+		l.add(path, fmt.Sprintf("invalid ~jw: template: the JWT template requires the key name and the claims: %s", arg))
+		return
+	}
+	if _, err := getJWTKey(parts[0]); err != nil {
+		l.add(path, fmt.Sprintf("invalid ~jw: template: %v", err))
+	}
+	var claims interface{}
+	if err := json.Unmarshal([]byte(parts[1]), &claims); err != nil {
+		l.add(path, fmt.Sprintf("invalid ~jw: template: unable to decode the JWT claims: %v", err))
+		return
+	}
+	l.lintValue(claims, path, false)
+}
+
+// lintAssertions compiles the assertion expressions with the same environment used at run time
+func (l *templateLinter) lintAssertions(assertions []string, path string) {
+	if len(assertions) == 0 {
+		return
+	}
+	env, err := getAssertEnv()
+	if err != nil {
+		l.add(path, fmt.Sprintf("unable to initialize the assertion environment: %v", err))
+		return
+	}
+	for i, expr := range assertions {
+		if _, iss := env.Compile(expr); iss != nil && iss.Err() != nil {
+			l.add(fmt.Sprintf("%s[%d]", path, i), fmt.Sprintf("invalid assertion %q: %v", expr, iss.Err()))
+		}
+	}
+}
+
+// lintCapture checks that the capture path refers to a field of the step, and checks its transformation chain
+func (l *templateLinter) lintCapture(capture string, path string) {
+	key := strings.SplitN(strings.SplitN(capture, ">", 2)[0], ".", 2)[0]
+	if _, ok := reflect.TypeOf(TestEntry{}).FieldByName(key); !ok || key == "" {
+		l.add(path, fmt.Sprintf("malformed capture path, unknown step field %s: %s", key, capture))
+		return
+	}
+	l.lintPath(capture, path, false, false)
+}
+
+// lintSchema checks that the JSON Schema file exists in the configuration directories
+func (l *templateLinter) lintSchema(file string, path string) {
+	if file == "" || strings.HasPrefix(file, fragmentArgPrefix) {
+		return
+	}
+	found, err := findConfigFile(file)
+	if err == nil {
+		_, err = os.Stat(found)
+	}
+	if err != nil {
+		l.add(path, fmt.Sprintf("unable to find the JSON schema %s", file))
+	}
+}
+
+// lintFragmentArg checks that the "~arg:" value refers to a parameter of the fragment;
+// in the test files the fragments are already expanded, so the remaining arguments are outside any fragment
+func (l *templateLinter) lintFragmentArg(arg string, path string) {
+	if l.checkRefs {
+		l.add(path, fmt.Sprintf("the fragment argument ~arg:%s can only be used in a fragment", arg))
+		return
+	}
+	if _, ok := l.params[arg]; !ok {
+		l.add(path, fmt.Sprintf("unknown fragment parameter: %s", arg))
+	}
+}
+
+// lintPath checks the path and the transformation chain of the "~pv:", "~var:" and "~pm:" templates,
+// and for the "~pv:" templates also the referenced step
+func (l *templateLinter) lintPath(arg string, path string, response bool, isStep bool) {
+	parts := strings.SplitN(arg, ">", 2)
+	keys := strings.Split(parts[0], ".")
+	for _, key := range keys {
+		if key == "" {
+			l.add(path, fmt.Sprintf("malformed template path: %s", arg))
+			return
+		}
+	}
+	if isStep {
+		if len(keys) > 1 {
+			if _, ok := reflect.TypeOf(TestEntry{}).FieldByName(keys[1]); !ok {
+				l.add(path, fmt.Sprintf("malformed ~pv: path, unknown step field %s: %s", keys[1], arg))
+			}
+		}
+		if l.checkRefs {
+			l.lintStepReference(keys[0], path, response)
+		}
+	}
+	if len(parts) < 2 {
+		return
+	}
+	for _, transf := range strings.Split(parts[1], ">") {
+		if strings.TrimSpace(transf) == "" {
+			l.add(path, fmt.Sprintf("empty transformation: %s", arg))
+			continue
+		}
+		if _, _, ok := getTransformer(transf); ok {
+			continue
+		}
+		l.lintCommand(strings.Fields(transf)[0], path)
+	}
+}
+
+// lintStepReference checks that the "~pv:" step index or name refers to a previous step,
+// or to the current step for the expected response
+func (l *templateLinter) lintStepReference(key string, path string, response bool) {
+	last := l.item - 1
+	if response {
+		last = l.item
+	}
+	idx, err := strconv.Atoi(key)
+	if err != nil {
+		idx = -1
+		for i, msg := range l.entries {
+			if msg.Name == key {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			l.add(path, fmt.Sprintf("unknown step: %s", key))
+			return
+		}
+	}
+	if idx < 0 || idx >= len(l.entries) {
+		l.add(path, fmt.Sprintf("unknown step index: %d", idx))
+		return
+	}
+	if idx > last {
+		if key != strconv.Itoa(idx) {
+			key = fmt.Sprintf("%s [%d]", key, idx)
+		}
+		l.add(path, fmt.Sprintf("forward reference to the step %s, which is executed later", key))
+	}
+}
+
+// lintCommand checks that the external command is in the list of the valid commands
+func (l *templateLinter) lintCommand(command string, path string) {
+	if _, ok := validTransfCmds[command]; !ok {
+		l.add(path, fmt.Sprintf("the command %s is not in validTransfCmd", command))
+	}
+}
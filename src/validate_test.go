@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidateRawTest(t *testing.T) {
+	setValidTransfCmds([]TransfCmd{{Path: "/bin/echo"}})
+	defer setValidTransfCmds(nil)
+	defer setTestJWTKeys(t)()
+
+	tests := []struct {
+		raw      string
+		source   string
+		problems []string // expected location and message prefix of each problem
+	}{
+		{
+			`[{"Name": "first", "Topic": "a", "Request": {"id": "~rd:uuid4=id"}, "Response": {"id": "~re:.*", "x": "~not:~absent"}},
+			  {"Topic": "b", "Request": {"id": "~pv:first.Response.id>upper>/bin/echo %v", "v": "~var:id>trim"}, "Response": "~pv:1.Request.id"}]`,
+			"test_x.json",
+			nil,
+		},
+		{`[{"Topic": "a", "Respnse": {}}]`, "test_x.json", []string{"test_x.json:[0]: additionalProperties 'Respnse' not allowed"}},
+		{`{"steps": [{"Topic": 1}]}`, "test_x.json", []string{"test_x.json:steps[0].Topic: expected string, but got number"}},
+		{"[\n{\"Topic\": }]", "test_x.json", []string{"test_x.json:2:11: invalid character"}},
+		{
+			`[{"Topic": "a", "Request": {"a": "~foo:bar", "b": "~pv:0..Request", "c": "~pv:0.Reqest", "d": "~var:x>/bin/false %v", "e": "~var:x>"},
+			   "Response": {"a": "~foo:bar", "b": "~xc:/bin/false:1", "c": "~not:~foo:1", "d": "~re:", "e": "~re"}}]`,
+			"test_x.json",
+			[]string{
+				"test_x.json:steps[0].Request.a: unknown template prefix: ~foo:",
+				"test_x.json:steps[0].Request.b: malformed template path",
+				"test_x.json:steps[0].Request.c: malformed ~pv: path, unknown step field Reqest",
+				"test_x.json:steps[0].Request.c: forward reference to the step 0,",
+				"test_x.json:steps[0].Request.d: the command /bin/false is not in validTransfCmd",
+				"test_x.json:steps[0].Request.e: empty transformation",
+				"test_x.json:steps[0].Response.a: unknown template prefix or matcher: ~foo:",
+				"test_x.json:steps[0].Response.b: the command /bin/false is not in validTransfCmd",
+				"test_x.json:steps[0].Response.c: unknown template prefix or matcher: ~foo:",
+				"test_x.json:steps[0].Response.d: missing argument of the matcher ~re:",
+			},
+		},
+		{
+			`[{"Topic": "a", "Request": {"id": "~arg:id"}}]`,
+			"test_x.json",
+			[]string{"test_x.json:steps[0].Request.id: the fragment argument ~arg:id can only be used in a fragment"},
+		},
+		{
+			"steps:\n  - Topic: a\n    Request: {id: \"~pv:next.Response.id\"}\n  - Name: next\n    Topic: b\n    Request: {id: \"~pv:5.Request\"}\n",
+			"test_x.yaml",
+			[]string{
+				"test_x.yaml:steps[0].Request.id: forward reference to the step next [1]",
+				"test_x.yaml:steps[1].Request.id: unknown step index: 5",
+			},
+		},
+		{
+			`{"steps": [{"Request": {}}, {"Topic": "a", "When": "vars.x ==", "Retry": {}}, {"Include": "missing"}]}`,
+			"test_x.json",
+			[]string{"test_x.json: test_x.json:steps[2]: unable to find the fragment missing"},
+		},
+		{
+			`{"steps": [{"Request": {}}, {"Topic": "a", "When": "vars.x ==", "Retry": {}}]}`,
+			"test_x.json",
+			[]string{
+				"test_x.json:steps[0]: the entry requires a Topic",
+				"test_x.json:steps[1].Retry: the retry policy requires",
+				"test_x.json:steps[1]: invalid condition",
+			},
+		},
+		{
+			`[{"Topic": "a", "Request": {"a": "~ts:+1h,tz=UTC|unix", "b": "~rd:int:1:9=qty", "c": "~tp:{{ var \"qty\" }}", "d": "~jw:hs:{\"sub\": \"~var:user\"}", "e": "~env:HOME"},
+			   "Assert": ["response.id == request.id"], "Capture": {"id": "Response.id>upper"}}]`,
+			"test_x.json",
+			nil,
+		},
+		{
+			`[{"Topic": "a", "Request": {"a": "~ts:+1x|unix", "b": "~rd:int:9:1", "c": "~tp:{{ .x", "d": "~jw:missing:{}", "e": "~jw:hs:{", "f": "~jw:hs:{\"sub\": \"~foo:1\"}", "g": "~env:", "h": "~rd:str:2000000000"},
+			   "Assert": ["response.id ==", "true"], "Capture": {"a": "Respnse.id", "b": "Response..id"}, "Schema": "missing_schema.json"}]`,
+			"test_x.json",
+			[]string{
+				"test_x.json:steps[0].Request.a: invalid ~ts: template: invalid time offset",
+				"test_x.json:steps[0].Request.b: invalid ~rd: template: invalid maximum value",
+				"test_x.json:steps[0].Request.c: invalid ~tp: template:",
+				"test_x.json:steps[0].Request.d: invalid ~jw: template: unable to find the JWT key: missing",
+				"test_x.json:steps[0].Request.e: invalid ~jw: template: unable to decode the JWT claims",
+				"test_x.json:steps[0].Request.f.sub: unknown template prefix: ~foo:",
+				"test_x.json:steps[0].Request.g: invalid ~env: template: missing environment variable name",
+				"test_x.json:steps[0].Request.h: invalid ~rd: template: the length of the random string exceeds the maximum",
+				"test_x.json:steps[0].Assert[0]: invalid assertion",
+				"test_x.json:steps[0].Capture.a: malformed capture path, unknown step field Respnse",
+				"test_x.json:steps[0].Capture.b: malformed template path",
+				"test_x.json:steps[0].Schema: unable to find the JSON schema missing_schema.json",
+			},
+		},
+	}
+	for i, tt := range tests {
+		problems := validateRawTest([]byte(tt.raw), tt.source, map[string]TestFragment{})
+		if len(problems) != len(tt.problems) {
+			t.Error(fmt.Errorf("[%d] found different problems than expected: %v", i, problems))
+			continue
+		}
+		for _, expected := range tt.problems {
+			found := false
+			for _, p := range problems {
+				found = found || strings.HasPrefix(p.Location+": "+p.Message, expected)
+			}
+			if !found {
+				t.Error(fmt.Errorf("[%d] the problem %q was expected, found: %v", i, expected, problems))
+			}
+		}
+	}
+}
+
+func TestValidateRawFragment(t *testing.T) {
+	problems := validateRawFragment([]byte(`{"params": {"topic": {}}, "steps": [{"Topic": "~arg:topic", "Request": {"id": "~pv:login.Response.id", "user": "~pm:user"}}]}`), "fragment_x.json")
+	if len(problems) != 0 {
+		t.Error(fmt.Errorf("no problems were expected: %v", problems))
+	}
+	problems = validateRawFragment([]byte(`[{"Topic": "a", "Request": "~arg:topic"}]`), "fragment_x.json")
+	if len(problems) != 1 || problems[0].Message != "unknown fragment parameter: topic" {
+		t.Error(fmt.Errorf("found different problems than expected: %v", problems))
+	}
+	problems = validateRawFragment([]byte(`{"params": {}, "steps": [{"Topic": "a", "Request": "~xx:1"}], "tags": []}`), "fragment_x.json")
+	if len(problems) != 2 || problems[0].Location != "fragment_x.json:" || problems[1].Location != "fragment_x.json:steps[0].Request" {
+		t.Error(fmt.Errorf("found different problems than expected: %v", problems))
+	}
+}
+
+func TestValidateTestFiles(t *testing.T) {
+	setValidTransfCmds([]TransfCmd{{Path: "/bin/echo"}})
+	defer setValidTransfCmds(nil)
+	frags := testFragments
+	reports, err := validateTestFiles([]string{"all", "@cli"})
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+	if len(reports) < 2 || countProblems(reports) != 0 {
+		t.Error(fmt.Errorf("no problems were expected: %v", reports))
+	}
+	if fmt.Sprint(frags) != fmt.Sprint(testFragments) {
+		t.Error(fmt.Errorf("the loaded fragments were not expected to change"))
+	}
+	for _, report := range reports {
+		if strings.HasSuffix(report.File, "test_@internal.json") {
+			t.Error(fmt.Errorf("the internal tests were not expected with 'all'"))
+		}
+	}
+	if _, err = validateTestFiles([]string{"missing"}); err == nil {
+		t.Error(fmt.Errorf("an error was expected"))
+	}
+}
+
+func TestGetPointerPath(t *testing.T) {
+	tests := map[string]string{
+		"":                      "",
+		"/0":                    "[0]",
+		"/steps/1/Request/a~1b": "steps[1].Request.a/b",
+		"/fragments/x~0y/steps": "fragments.x~y.steps",
+	}
+	for pointer, expected := range tests {
+		if path := getPointerPath(pointer); path != expected {
+			t.Error(fmt.Errorf("%s: found different value than expected: %s", pointer, path))
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats"
+)
+
+// testRun is the context of the current test run, cancelled by the /cancel entry point
+var testRun = context.Background()
+
+// testRunCancel is the function that cancels the current test run (nil if no test is in progress)
+var testRunCancel context.CancelFunc
+
+// testRunMutex protects testRunCancel, which is called by the /cancel entry point while the test is running
+var testRunMutex sync.Mutex
+
+// waitSubscription is a subscription opened before the execution of the entry preceding a WaitFor entry,
+// so the messages published in response to that entry are not lost
+type waitSubscription struct {
+	item        int            // position of the WaitFor entry in the test cache
+	subject     string         // subscribed subject
+	ch          chan *nats.Msg // received messages
+	unsubscribe func()         // function that closes the subscription
+}
+
+// testWaitSubscription is the subscription opened in advance for the next WaitFor entry (nil if none)
+var testWaitSubscription *waitSubscription
+
+// startTestRun creates a new cancellable context for the test run
+func startTestRun() {
+	testRunMutex.Lock()
+	defer testRunMutex.Unlock()
+	testRun, testRunCancel = context.WithCancel(context.Background())
+}
+
+// endTestRun releases the context of the test run
+func endTestRun() {
+	testRunMutex.Lock()
+	defer testRunMutex.Unlock()
+	if testRunCancel != nil {
+		testRunCancel()
+	}
+	testRun, testRunCancel = context.Background(), nil
+}
+
+// cancelTestRun cancels the current test run, returning false if no test is in progress
+func cancelTestRun() bool {
+	testRunMutex.Lock()
+	defer testRunMutex.Unlock()
+	if testRunCancel == nil {
+		return false
+	}
+	testRunCancel()
+	return true
+}
+
+// startTeardown replaces the context of the test run with a new context limited to TeardownTimeout,
+// so the teardown entries are executed even if the test run has been cancelled, and can be cancelled again;
+// the returned function restores the context of the test run
+func startTeardown() func() {
+	testRunMutex.Lock()
+	defer testRunMutex.Unlock()
+	run, runCancel := testRun, testRunCancel
+	ctx, cancel := context.WithTimeout(context.Background(), TeardownTimeout*time.Millisecond)
+	testRun = ctx
+	if runCancel != nil {
+		// the teardown can be cancelled only when a test run is in progress
+		testRunCancel = cancel
+	}
+	return func() {
+		testRunMutex.Lock()
+		defer testRunMutex.Unlock()
+		cancel()
+		testRun, testRunCancel = run, runCancel
+	}
+}
+
+// checkTestRun returns an error if the current test run has been cancelled, or if the teardown time limit is exceeded
+func checkTestRun() error {
+	switch testRun.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return fmt.Errorf("the teardown has exceeded the time limit of %d ms", TeardownTimeout)
+	}
+	return fmt.Errorf("the test run has been cancelled")
+}
+
+// waitDelay pauses the test for the specified time, returning an error if the test run is cancelled in the meantime
+func waitDelay(delay time.Duration) error {
+	if delay <= 0 {
+		return checkTestRun()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-testRun.Done():
+		return checkTestRun()
+	}
+}
+
+// isWaitStep returns true if the test entry waits instead of sending a request
+func isWaitStep(msg TestEntry) bool {
+	return msg.Delay > 0 || msg.WaitUntil != "" || msg.WaitFor != ""
+}
+
+// checkWaitStep returns an error if the Delay, WaitUntil and WaitFor options of the test entry are not valid
+func checkWaitStep(msg TestEntry) error {
+	if msg.Delay < 0 || msg.Delay > MaxWaitDelay {
+		return fmt.Errorf("the delay value must be between 0 and %d", MaxWaitDelay)
+	}
+	count := 0
+	for _, set := range []bool{msg.Delay > 0, msg.WaitUntil != "", msg.WaitFor != ""} {
+		if set {
+			count++
+		}
+	}
+	switch {
+	case count == 0:
+		return nil
+	case count > 1:
+		return fmt.Errorf("the delay, waitUntil and waitFor options are mutually exclusive")
+	case msg.Topic != "" || msg.Request != nil:
+		return fmt.Errorf("the wait steps cannot send a request")
+	case msg.Retry != nil:
+		return fmt.Errorf("the wait steps cannot have a retry policy")
+	case msg.WaitFor == "" && (msg.Response != nil || msg.Schema != "" || len(msg.Assert) > 0 || len(msg.Capture) > 0):
+		return fmt.Errorf("only the waitFor steps can check a response")
+	}
+	return nil
+}
+
+// execWaitStep pauses the test for a fixed delay, until the specified time or until a message is received
+func execWaitStep(msg TestEntry, item int, defaults TestDefaults) error {
+	testCache[item].Name = msg.Name
+	switch {
+	case msg.Delay > 0:
+		err := waitDelay(time.Duration(msg.Delay) * time.Millisecond)
+		if err != nil {
+			return fmt.Errorf("delay [%d]: %v", item, err)
+		}
+		return nil
+	case msg.WaitUntil != "":
+		err := waitUntil(msg.WaitUntil)
+		if err != nil {
+			return fmt.Errorf("waitUntil [%d]: %v", item, err)
+		}
+		return nil
+	}
+	return execWaitForStep(msg, item, defaults)
+}
+
+// waitUntil pauses the test until the time returned by the template (RFC 3339 or Unix timestamp)
+func waitUntil(until string) error {
+	value, err := replaceTemplates(until)
+	if err != nil {
+		return fmt.Errorf("unable to process the template %s: %v", until, err)
+	}
+	t, err := getTimeValue(value)
+	if err != nil {
+		return err
+	}
+	delay := time.Until(t)
+	if delay > time.Duration(MaxWaitDelay)*time.Millisecond {
+		return fmt.Errorf("the time %v is more than %d ms in the future", value, MaxWaitDelay)
+	}
+	return waitDelay(delay)
+}
+
+// getWaitForSubject returns the subject of the WaitFor entry, resolving the template
+func getWaitForSubject(waitFor string) (string, error) {
+	value, err := replaceTemplates(waitFor)
+	subject, ok := value.(string)
+	if err != nil || !ok || subject == "" {
+		return "", fmt.Errorf("invalid waitFor subject: %v %v", value, err)
+	}
+	return subject, nil
+}
+
+// prepareWaitFor is called before the execution of the specified entry, and opens in advance the subscription of the
+// following entry if it is a WaitFor entry with a subject that can already be resolved, and the current entry is not
+// a WaitFor entry itself; the offset is the position of the first entry in the test cache
+func prepareWaitFor(entries TestEntries, item int, offset int) {
+	if testWaitSubscription != nil && testWaitSubscription.item != offset+item {
+		closeWaitSubscription()
+	}
+	next := item + 1
+	if next >= len(entries) || entries[next].WaitFor == "" || entries[item].WaitFor != "" {
+		return
+	}
+	subject, err := getWaitForSubject(entries[next].WaitFor)
+	if err != nil {
+		// the subject depends on the current entry
+		return
+	}
+	ch, unsubscribe, err := subscribeBus(subject)
+	if err != nil {
+		return
+	}
+	testWaitSubscription = &waitSubscription{item: offset + next, subject: subject, ch: ch, unsubscribe: unsubscribe}
+}
+
+// closeWaitSubscription closes the subscription opened in advance, if any
+func closeWaitSubscription() {
+	if testWaitSubscription != nil {
+		testWaitSubscription.unsubscribe()
+		testWaitSubscription = nil
+	}
+}
+
+// subscribeWaitFor returns the subscription opened in advance for the WaitFor entry, or a new subscription
+func subscribeWaitFor(subject string, item int) (chan *nats.Msg, func(), error) {
+	if sub := testWaitSubscription; sub != nil && sub.item == item {
+		testWaitSubscription = nil
+		if sub.subject == subject {
+			return sub.ch, sub.unsubscribe, nil
+		}
+		sub.unsubscribe()
+	}
+	return subscribeBus(subject)
+}
+
+// execWaitForStep waits until a message matching the expected response is received on the subject,
+// and then captures the variables as for the request entries
+func execWaitForStep(msg TestEntry, item int, defaults TestDefaults) error {
+	subject, err := getWaitForSubject(msg.WaitFor)
+	if err != nil {
+		return fmt.Errorf("%s [%d]: %v", msg.WaitFor, item, err)
+	}
+	testCache[item].Topic = subject
+	msg.Topic = subject
+
+	ch, unsubscribe, err := subscribeWaitFor(subject, item)
+	if err != nil {
+		return fmt.Errorf("%s [%d]: %v", subject, item, err)
+	}
+	defer unsubscribe()
+	timeout := getStepTimeout(msg, defaults)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	testStepTime = time.Now().UTC()
+	var lastErr error
+	for {
+		select {
+		case <-testRun.Done():
+			return fmt.Errorf("%s [%d]: %v", subject, item, checkTestRun())
+		case <-timer.C:
+			if lastErr != nil {
+				return fmt.Errorf("%v (no matching message received within %v)", lastErr, timeout)
+			}
+			return fmt.Errorf("%s [%d]: no message received within %v", subject, item, timeout)
+		case received := <-ch:
+			var resp interface{}
+			err = json.Unmarshal(received.Data, &resp)
+			if err != nil {
+				lastErr = fmt.Errorf("%s [%d]: unable to decode the message: %v", subject, item, err)
+				continue
+			}
+			testCache[item].Response = resp
+			lastErr = checkResponse(msg, item, resp, defaults)
+			if lastErr != nil {
+				continue
+			}
+			err = captureVariables(msg.Capture, item)
+			if err != nil {
+				return fmt.Errorf("%s [%d]: %v", subject, item, err)
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats"
+)
+
+// openTestPublisher opens a separate NATS connection to publish the test messages,
+// since the global connection is opened and closed by the test execution
+func openTestPublisher(t *testing.T) *nats.Conn {
+	conn, err := natsOpts.Connect()
+	if err != nil {
+		t.Fatal(fmt.Errorf("unable to connect to the NATS bus: %v", err))
+	}
+	return conn
+}
+
+func TestCheckWaitStep(t *testing.T) {
+	valid := []TestEntry{
+		{},
+		{Delay: 100},
+		{WaitUntil: "~var:nextRun"},
+		{WaitFor: "orders.shipped", Response: map[string]interface{}{"id": 1}, Capture: map[string]string{"id": "Response.id"}},
+	}
+	for _, msg := range valid {
+		if err := checkWaitStep(msg); err != nil {
+			t.Error(fmt.Errorf("%+v: an error was not expected: %v", msg, err))
+		}
+	}
+	invalid := []TestEntry{
+		{Delay: -1},
+		{Delay: MaxWaitDelay + 1},
+		{Delay: 100, WaitFor: "orders.shipped"},
+		{Delay: 100, Topic: "orders.get"},
+		{WaitFor: "orders.shipped", Request: map[string]interface{}{"id": 1}},
+		{WaitFor: "orders.shipped", Retry: &TestRetry{MaxAttempts: 2}},
+		{WaitUntil: "~var:nextRun", Response: map[string]interface{}{"id": 1}},
+	}
+	for _, msg := range invalid {
+		if err := checkWaitStep(msg); err == nil {
+			t.Error(fmt.Errorf("%+v: an error was expected", msg))
+		}
+	}
+}
+
+func TestWaitDelayCancel(t *testing.T) {
+	if cancelTestRun() {
+		t.Error(fmt.Errorf("no test run was expected"))
+	}
+	startTestRun()
+	defer endTestRun()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancelTestRun()
+	}()
+	start := time.Now()
+	err := waitDelay(time.Hour)
+	if err == nil || time.Since(start) > time.Second {
+		t.Error(fmt.Errorf("the delay was expected to be cancelled: %v", err))
+	}
+	if err = waitDelay(0); err == nil {
+		t.Error(fmt.Errorf("an error was expected after the cancellation"))
+	}
+}
+
+func TestExecTestWait(t *testing.T) {
+	initNatsBus("nats://127.0.0.1:4222")
+	def := TestFile{Steps: TestEntries{
+		{Delay: 5},
+		{WaitUntil: "~ts:live,+20ms|rfc3339nano"},
+		{
+			Name:     "shipped",
+			WaitFor:  "~var:subject",
+			Timeout:  2000,
+			Response: map[string]interface{}{"status": "SHIPPED"},
+			Capture:  map[string]string{"status": "Response.status"},
+		},
+	}}
+
+	// publish the messages until the test ends
+	conn := openTestPublisher(t)
+	defer conn.Close()
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+				_ = conn.Publish("@.wait.123", []byte(`{"status":"PENDING"}`))
+				_ = conn.Publish("@.wait.123", []byte(`{"status":"SHIPPED"}`))
+			}
+		}
+	}()
+
+	start := time.Now()
+	err := execTestFile(def, TestRow{"subject": "@.wait.123"})
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+	if time.Since(start) < 25*time.Millisecond {
+		t.Error(fmt.Errorf("the test was expected to wait: %v", time.Since(start)))
+	}
+	if testVars["status"] != "SHIPPED" || testCache[2].Topic != "@.wait.123" {
+		t.Error(fmt.Errorf("the received message was expected to be captured: %v %v", testVars, testCache[2]))
+	}
+
+	def.Steps = TestEntries{{WaitFor: "@.wait.none", Timeout: 20, Response: map[string]interface{}{"status": "SHIPPED"}}}
+	err = execTestFile(def, nil)
+	if err == nil || !strings.Contains(err.Error(), "no message received within 20ms") {
+		t.Error(fmt.Errorf("a timeout error was expected, found: %v", err))
+	}
+
+	def.Steps = TestEntries{{WaitUntil: "invalid"}}
+	err = execTestFile(def, nil)
+	if err == nil {
+		t.Error(fmt.Errorf("an error was expected"))
+	}
+}
+
+func TestRunTestCancel(t *testing.T) {
+	initNatsBus("nats://127.0.0.1:4222")
+	defs := testDefs
+	defer func() { testDefs = defs }()
+	testDefs = map[string]TestFile{
+		"@wait": {
+			Steps: TestEntries{{Delay: MaxWaitDelay}, {Topic: "@.wait.test", Request: "step"}},
+			Teardown: TestEntries{{
+				Topic:    "@.wait.test",
+				Request:  map[string]interface{}{"id": "cleanup"},
+				Response: map[string]interface{}{"id": "cleanup"},
+				Capture:  map[string]string{"cleanup": "Response.id"},
+			}},
+		},
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancelTestRun()
+	}()
+	startTestRun()
+	_, err := runTest("@wait", nil)
+	endTestRun()
+	if err == nil || !strings.Contains(err.Error(), "the test run has been cancelled") {
+		t.Error(fmt.Errorf("a cancellation error was expected, found: %v", err))
+	}
+	if testVars["cleanup"] != "cleanup" || testCache[1].Request != nil {
+		t.Error(fmt.Errorf("only the teardown entries were expected after the cancellation: %v", testVars))
+	}
+}
+
+func TestExecTestWaitForPreviousStep(t *testing.T) {
+	initNatsBus("nats://127.0.0.1:4222")
+	// the message is published while the previous step is executed
+	conn := openTestPublisher(t)
+	defer conn.Close()
+	published := make(chan bool)
+	go func() {
+		defer close(published)
+		time.Sleep(10 * time.Millisecond)
+		_ = conn.Publish("@.wait.early", []byte(`{"status":"SHIPPED"}`))
+	}()
+	defer func() { <-published }()
+	def := TestFile{Steps: TestEntries{
+		{Delay: 50},
+		{WaitFor: "@.wait.early", Timeout: 200, Response: map[string]interface{}{"status": "SHIPPED"}},
+	}}
+	err := execTestFile(def, nil)
+	if err != nil {
+		t.Error(fmt.Errorf("the message published during the previous step was expected to be received: %v", err))
+	}
+	if testWaitSubscription != nil {
+		t.Error(fmt.Errorf("the subscription opened in advance was expected to be closed"))
+	}
+}
+
+func TestRunTestCancelTeardown(t *testing.T) {
+	initNatsBus("nats://127.0.0.1:4222")
+	defs := testDefs
+	defer func() { testDefs = defs }()
+	testDefs = map[string]TestFile{
+		"@wait": {
+			Steps:    TestEntries{{Delay: MaxWaitDelay}},
+			Teardown: TestEntries{{Delay: MaxWaitDelay}},
+		},
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancelTestRun()
+		time.Sleep(20 * time.Millisecond)
+		cancelTestRun()
+	}()
+	start := time.Now()
+	startTestRun()
+	_, err := runTest("@wait", nil)
+	endTestRun()
+	if err == nil || !strings.Contains(err.Error(), "; teardown: ") || time.Since(start) > time.Second {
+		t.Error(fmt.Errorf("the teardown was expected to be cancelled, found: %v", err))
+	}
+	if testRun.Err() != nil || testRunCancel != nil {
+		t.Error(fmt.Errorf("the test run context was expected to be restored"))
+	}
+}
+
+func TestCheckTestRunTeardownTimeout(t *testing.T) {
+	run := testRun
+	defer func() { testRun = run }()
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	testRun = ctx
+	err := checkTestRun()
+	if err == nil || !strings.Contains(err.Error(), "time limit") {
+		t.Error(fmt.Errorf("a time limit error was expected, found: %v", err))
+	}
+}
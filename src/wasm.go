@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// WasmPlugin contains the configuration of a WebAssembly plugin
+type WasmPlugin struct {
+	Name        string `mapstructure:"name" json:"name"`               // name of the matcher, transformation and/or template prefix
+	File        string `mapstructure:"file" json:"file"`               // WebAssembly module file
+	Timeout     int    `mapstructure:"timeout" json:"timeout"`         // maximum execution time of each call in milliseconds
+	MemoryLimit int    `mapstructure:"memoryLimit" json:"memoryLimit"` // maximum memory size in pages of 64 KiB
+}
+
+// wasmModule is a compiled WebAssembly plugin module.
+// Each call runs in a new module instance without access to the file system, the network or the environment.
+//
+// The module must export the memory, the "alloc(size i32) i32" function and at least one of the following functions:
+//   - "match(ptr i32, len i32) i64" : receives the JSON object {"arg": ARG, "actual": VALUE} and returns {"error": MESSAGE};
+//   - "transform(ptr i32, len i32) i64" : receives the JSON object {"value": VALUE, "args": [ARGS]} and returns {"value": VALUE, "error": MESSAGE};
+//   - "template(ptr i32, len i32) i64" : receives the JSON object {"arg": ARG} and returns {"value": VALUE, "error": MESSAGE}.
+//
+// The returned i64 contains the pointer of the JSON result in the upper 32 bits and its length in the lower 32 bits.
+type wasmModule struct {
+	cfg           WasmPlugin
+	runtime       wazero.Runtime
+	compiled      wazero.CompiledModule
+	isMatcher     bool // true if the module is registered as matcher
+	isTransformer bool // true if the module is registered as transformation
+	isTemplate    bool // true if the module is registered as template prefix
+}
+
+// wasmResult contains the result of a WebAssembly plugin call
+type wasmResult struct {
+	Value interface{} `json:"value"` // transformed value
+	Error string      `json:"error"` // error message (if any)
+}
+
+// wasmModules contains the loaded WebAssembly plugins
+var wasmModules []*wasmModule
+
+// loadWasmPlugins compiles the WebAssembly plugins and registers their matchers, transformations and template prefixes
+func loadWasmPlugins(plugins []WasmPlugin) error {
+	closeWasmPlugins()
+	for _, cfg := range plugins {
+		mod, err := newWasmModule(cfg)
+		if err != nil {
+			return fmt.Errorf("unable to load the WebAssembly plugin %s: %v", cfg.Name, err)
+		}
+		wasmModules = append(wasmModules, mod)
+		exports := mod.compiled.ExportedFunctions()
+		_, hasAlloc := exports["alloc"]
+		_, hasMatch := exports["match"]
+		_, hasTransform := exports["transform"]
+		_, hasTemplate := exports["template"]
+		if !hasAlloc || (!hasMatch && !hasTransform && !hasTemplate) {
+			return fmt.Errorf("the WebAssembly plugin %s must export the alloc function and the match, transform or template functions", cfg.Name)
+		}
+		if hasMatch {
+			err = RegisterMatcher(cfg.Name, MatcherFunc(mod.Match))
+			mod.isMatcher = err == nil
+		}
+		if err == nil && hasTransform {
+			err = RegisterTransformer(cfg.Name, TransformerFunc(mod.Transform))
+			mod.isTransformer = err == nil
+		}
+		if err == nil && hasTemplate {
+			err = RegisterTemplate(cfg.Name, TemplateFunc(mod.Template))
+			mod.isTemplate = err == nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeWasmPlugins unregisters the loaded WebAssembly plugins and releases their resources
+func closeWasmPlugins() {
+	for _, mod := range wasmModules {
+		if mod.isMatcher {
+			delete(matchers, mod.cfg.Name)
+		}
+		if mod.isTransformer {
+			delete(transformers, mod.cfg.Name)
+		}
+		if mod.isTemplate {
+			delete(templateProviders, mod.cfg.Name)
+		}
+		_ = mod.runtime.Close(context.Background())
+	}
+	wasmModules = nil
+}
+
+// newWasmModule compiles the WebAssembly module of the plugin
+func newWasmModule(cfg WasmPlugin) (*wasmModule, error) {
+	if !pluginName.MatchString(cfg.Name) || reservedNames[cfg.Name] {
+		return nil, fmt.Errorf("invalid plugin name: %s", cfg.Name)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = CmdTimeout
+	}
+	if cfg.MemoryLimit <= 0 {
+		cfg.MemoryLimit = WasmMemoryLimit
+	}
+	path, err := findConfigFile(cfg.File)
+	if err != nil {
+		return nil, err
+	}
+	/* #nosec */
+	binary, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	rcfg := wazero.NewRuntimeConfig().WithMemoryLimitPages(uint32(cfg.MemoryLimit)).WithCloseOnContextDone(true)
+	runtime := wazero.NewRuntimeWithConfig(ctx, rcfg)
+	// WASI is required by most compilers, but no file system, network or environment is exposed
+	_, err = wasi_snapshot_preview1.Instantiate(ctx, runtime)
+	if err == nil {
+		var compiled wazero.CompiledModule
+		compiled, err = runtime.CompileModule(ctx, binary)
+		if err == nil {
+			return &wasmModule{cfg: cfg, runtime: runtime, compiled: compiled}, nil
+		}
+	}
+	_ = runtime.Close(ctx)
+	return nil, err
+}
+
+// Match calls the match function of the WebAssembly plugin
+func (mod *wasmModule) Match(arg string, actual interface{}) error {
+	res, err := mod.call("match", map[string]interface{}{"arg": arg, "actual": actual})
+	if err != nil {
+		return err
+	}
+	if res.Error != "" {
+		return getFormattedDiffError(res.Error, "~"+mod.cfg.Name+":"+arg, actual)
+	}
+	return nil
+}
+
+// Transform calls the transform function of the WebAssembly plugin
+func (mod *wasmModule) Transform(value interface{}, args []string) (interface{}, error) {
+	res, err := mod.call("transform", map[string]interface{}{"value": value, "args": args})
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != "" {
+		return nil, fmt.Errorf("%s", res.Error)
+	}
+	return res.Value, nil
+}
+
+// Template calls the template function of the WebAssembly plugin
+func (mod *wasmModule) Template(arg string) (interface{}, error) {
+	res, err := mod.call("template", map[string]interface{}{"arg": arg})
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != "" {
+		return nil, fmt.Errorf("%s", res.Error)
+	}
+	return res.Value, nil
+}
+
+// call executes the exported function of a new module instance with the JSON-encoded input
+func (mod *wasmModule) call(name string, input interface{}) (res wasmResult, err error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return res, fmt.Errorf("unable to encode the plugin input: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(mod.cfg.Timeout)*time.Millisecond)
+	defer cancel()
+	inst, err := mod.runtime.InstantiateModule(ctx, mod.compiled, wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize"))
+	if err != nil {
+		return res, fmt.Errorf("unable to instantiate the plugin %s: %v", mod.cfg.Name, err)
+	}
+	defer func() { _ = inst.Close(context.Background()) }()
+	if inst.Memory() == nil {
+		return res, fmt.Errorf("the plugin %s does not export the memory", mod.cfg.Name)
+	}
+	ret, err := inst.ExportedFunction("alloc").Call(ctx, uint64(len(data)))
+	if err != nil || len(ret) != 1 {
+		return res, fmt.Errorf("unable to allocate the plugin %s memory: %v", mod.cfg.Name, err)
+	}
+	ptr := uint32(ret[0])
+	if !inst.Memory().Write(ptr, data) {
+		return res, fmt.Errorf("unable to write the plugin %s memory", mod.cfg.Name)
+	}
+	ret, err = inst.ExportedFunction(name).Call(ctx, uint64(ptr), uint64(len(data)))
+	if ctx.Err() == context.DeadlineExceeded {
+		return res, fmt.Errorf("the plugin %s timed out after %d ms", mod.cfg.Name, mod.cfg.Timeout)
+	}
+	if err != nil || len(ret) != 1 {
+		return res, fmt.Errorf("unable to call the plugin %s: %v", mod.cfg.Name, err)
+	}
+	out, ok := inst.Memory().Read(uint32(ret[0]>>32), uint32(ret[0]))
+	if !ok {
+		return res, fmt.Errorf("unable to read the plugin %s result", mod.cfg.Name)
+	}
+	err = json.Unmarshal(out, &res)
+	if err != nil {
+		return res, fmt.Errorf("unable to decode the plugin %s result: %v", mod.cfg.Name, err)
+	}
+	return res, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// wasmModuleHeader contains the types (i32)->i32 and (i32, i32)->i64 and a memory of one page,
+// followed by the sections of the test modules
+const wasmModuleHeader = "\x00asm\x01\x00\x00\x00\x01\x0c\x02\x60\x01\x7f\x01\x7f\x60\x02\x7f\x7f\x01\x7e"
+
+// wasmTrapModule exports the memory, alloc and a match function that always traps (unreachable)
+const wasmTrapModule = wasmModuleHeader + "\x03\x03\x02\x00\x01\x05\x03\x01\x00\x01" +
+	"\x07\x1a\x03\x06memory\x02\x00\x05alloc\x00\x00\x05match\x00\x01" +
+	"\x0a\x0a\x02\x04\x00\x41\x00\x0b\x03\x00\x00\x0b"
+
+// wasmAllocModule exports only the memory and alloc
+const wasmAllocModule = wasmModuleHeader + "\x03\x02\x01\x00\x05\x03\x01\x00\x01" +
+	"\x07\x12\x02\x06memory\x02\x00\x05alloc\x00\x00" +
+	"\x0a\x06\x01\x04\x00\x41\x00\x0b"
+
+// wasmTemplateModule exports the memory, alloc and a template function returning {"value":"wasm"}
+const wasmTemplateModule = wasmModuleHeader + "\x03\x03\x02\x00\x01\x05\x03\x01\x00\x01" +
+	"\x07\x1d\x03\x06memory\x02\x00\x05alloc\x00\x00\x08template\x00\x01" +
+	"\x0a\x11\x02\x04\x00\x41\x00\x0b\x0a\x00\x42\x90\x80\x80\x80\x80\x80\x01\x0b" +
+	"\x0b\x17\x01\x00\x41\x80\x08\x0b\x10{\"value\":\"wasm\"}"
+
+// writeTestWasmFile writes a WebAssembly module in the directory and returns its path
+func writeTestWasmFile(t *testing.T, dir string, name string, module string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(module), 0600); err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+	return path
+}
+
+func TestLoadWasmPlugins(t *testing.T) {
+	err := loadWasmPlugins(nil)
+	if err != nil || len(wasmModules) != 0 {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+
+	dir, err := ioutil.TempDir("", "natstest-wasm")
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	invalid := filepath.Join(dir, "invalid.wasm")
+	empty := filepath.Join(dir, "empty.wasm")
+	_ = ioutil.WriteFile(invalid, []byte("not a module"), 0600)
+	// valid module without exported functions
+	_ = ioutil.WriteFile(empty, []byte("\x00asm\x01\x00\x00\x00"), 0600)
+
+	tests := []WasmPlugin{
+		{Name: "missing", File: filepath.Join(dir, "missing.wasm")},
+		{Name: "invalid", File: invalid},
+		{Name: "empty", File: empty},
+		{Name: "re", File: empty},
+		{Name: "bad-name", File: empty},
+	}
+	for _, tt := range tests {
+		err = loadWasmPlugins([]WasmPlugin{tt})
+		if err == nil {
+			t.Error(fmt.Errorf("%s: an error was expected", tt.Name))
+		}
+		if _, ok := matchers[tt.Name]; ok && tt.Name != "re" {
+			t.Error(fmt.Errorf("%s: the matcher was not expected", tt.Name))
+		}
+	}
+	closeWasmPlugins()
+	if _, ok := matchers["re"]; !ok {
+		t.Error(fmt.Errorf("the built-in matcher was unregistered"))
+	}
+}
+
+func TestLoadWasmPluginsErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "natstest-wasm")
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	defer closeWasmPlugins()
+
+	// valid header followed by a truncated section
+	bad := writeTestWasmFile(t, dir, "bad.wasm", wasmModuleHeader[:8]+"\x01\x0c\x02\x60")
+	err = loadWasmPlugins([]WasmPlugin{{Name: "bad", File: bad}})
+	if err == nil {
+		t.Error(fmt.Errorf("an error was expected (bad module)"))
+	}
+
+	alloc := writeTestWasmFile(t, dir, "alloc.wasm", wasmAllocModule)
+	err = loadWasmPlugins([]WasmPlugin{{Name: "alloc", File: alloc}})
+	if err == nil || !strings.Contains(err.Error(), "must export") {
+		t.Error(fmt.Errorf("a missing export error was expected, found: %v", err))
+	}
+	if _, ok := matchers["alloc"]; ok {
+		t.Error(fmt.Errorf("the matcher was not expected"))
+	}
+
+	trap := writeTestWasmFile(t, dir, "trap.wasm", wasmTrapModule)
+	err = loadWasmPlugins([]WasmPlugin{{Name: "trap", File: trap, Timeout: 1000}})
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	err = areMatching(map[string]interface{}{"id": "~trap:abc"}, map[string]interface{}{"id": "abc"})
+	if err == nil || !strings.Contains(err.Error(), "trap") {
+		t.Error(fmt.Errorf("the trap was expected to be reported as error, found: %v", err))
+	}
+	// the module can be called again after a trap, since each call uses a new instance
+	if err = areMatching("~trap:abc", "abc"); err == nil {
+		t.Error(fmt.Errorf("an error was expected"))
+	}
+}
+
+func TestLoadWasmPluginsTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "natstest-wasm")
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	file := writeTestWasmFile(t, dir, "template.wasm", wasmTemplateModule)
+	err = loadWasmPlugins([]WasmPlugin{{Name: "wasmtp", File: file}})
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+	}
+	if _, ok := templateProviders["wasmtp"]; !ok {
+		t.Error(fmt.Errorf("the template prefix was expected to be registered"))
+	}
+	if _, ok := matchers["wasmtp"]; ok {
+		t.Error(fmt.Errorf("the matcher was not expected"))
+	}
+	closeWasmPlugins()
+	if _, ok := templateProviders["wasmtp"]; ok {
+		t.Error(fmt.Errorf("the template prefix was expected to be unregistered"))
+	}
+	if _, ok := templateProviders["pv"]; !ok {
+		t.Error(fmt.Errorf("the built-in template prefix was unregistered"))
+	}
+}
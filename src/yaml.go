@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlMaxDepth is the maximum nesting level of the YAML documents, including the expanded aliases
+const yamlMaxDepth = 100
+
+// yamlMaxSize is the maximum size in bytes of the JSON document converted from YAML, to limit the alias expansion
+const yamlMaxSize = 32 * 1024 * 1024
+
+// yamlSpan maps a portion of the JSON document converted from YAML to the position of the source node
+type yamlSpan struct {
+	start int // offset of the first byte of the JSON value
+	end   int // offset after the last byte of the JSON value
+	node  *yaml.Node
+}
+
+// yamlEncoder converts a YAML node tree to JSON, keeping track of the source positions
+type yamlEncoder struct {
+	buf   bytes.Buffer
+	spans []yamlSpan
+}
+
+// load the test from a YAML string containing either a list of test entries or a TestFile object
+func loadRawYAMLTest(raw []byte, name string) error {
+	return loadRawTest(raw, name, "test_"+name+".yaml")
+}
+
+// decodeYAMLTest decodes a YAML string containing either a list of test entries or a TestFile object
+func decodeYAMLTest(raw []byte) (TestFile, error) {
+	data, enc, err := yamlToJSON(raw)
+	if err != nil {
+		return TestFile{}, err
+	}
+	testData, err := decodeJSONTest(data)
+	if err != nil {
+		return testData, enc.getPositionError(err)
+	}
+	return testData, nil
+}
+
+// isYAMLContent returns true if the content type is YAML, or if the content is not a JSON object or array
+func isYAMLContent(contentType string, raw []byte) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return true
+	}
+	raw = bytes.TrimSpace(raw)
+	return len(raw) > 0 && raw[0] != '[' && raw[0] != '{'
+}
+
+// yamlToJSON converts a YAML document to JSON
+func yamlToJSON(raw []byte) ([]byte, *yamlEncoder, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(raw, &doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil, fmt.Errorf("the YAML document is empty")
+	}
+	enc := &yamlEncoder{}
+	err = enc.encode(doc.Content[0], 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return enc.buf.Bytes(), enc, nil
+}
+
+// encode writes the JSON representation of the YAML node
+func (enc *yamlEncoder) encode(node *yaml.Node, depth int) (err error) {
+	if depth > yamlMaxDepth {
+		return &positionError{Line: node.Line, Column: node.Column, Err: fmt.Errorf("the YAML document is too deeply nested")}
+	}
+	if enc.buf.Len() > yamlMaxSize {
+		return &positionError{Line: node.Line, Column: node.Column, Err: fmt.Errorf("the YAML document is too large")}
+	}
+	start := enc.buf.Len()
+	switch node.Kind {
+	case yaml.AliasNode:
+		return enc.encode(node.Alias, depth+1)
+	case yaml.MappingNode:
+		err = enc.encodeMapping(node, depth)
+	case yaml.SequenceNode:
+		enc.buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				enc.buf.WriteByte(',')
+			}
+			if err = enc.encode(item, depth+1); err != nil {
+				return err
+			}
+		}
+		enc.buf.WriteByte(']')
+	case yaml.ScalarNode:
+		err = enc.encodeScalar(node)
+	default:
+		err = fmt.Errorf("unsupported YAML node")
+	}
+	if err != nil {
+		return err
+	}
+	enc.spans = append(enc.spans, yamlSpan{start: start, end: enc.buf.Len(), node: node})
+	return nil
+}
+
+// encodeMapping writes a YAML mapping as JSON object, including the merged mappings ("<<" keys)
+func (enc *yamlEncoder) encodeMapping(node *yaml.Node, depth int) error {
+	enc.buf.WriteByte('{')
+	pairs := enc.getMappingPairs(node, 0)
+	for i := 0; i < len(pairs); i += 2 {
+		key, value := pairs[i], pairs[i+1]
+		if key.Kind != yaml.ScalarNode {
+			return &positionError{Line: key.Line, Column: key.Column, Err: fmt.Errorf("the mapping keys must be scalar values")}
+		}
+		if i > 0 {
+			enc.buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key.Value)
+		enc.buf.Write(k)
+		enc.buf.WriteByte(':')
+		if err := enc.encode(value, depth+1); err != nil {
+			return err
+		}
+	}
+	enc.buf.WriteByte('}')
+	return nil
+}
+
+// getMappingPairs returns the list of key and value nodes of a mapping, where the merged pairs precede the local ones
+func (enc *yamlEncoder) getMappingPairs(node *yaml.Node, depth int) []*yaml.Node {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind != yaml.MappingNode || depth > yamlMaxDepth {
+		return nil
+	}
+	var merged, pairs []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Tag != "!!merge" {
+			pairs = append(pairs, key, value)
+			continue
+		}
+		if value.Kind == yaml.SequenceNode {
+			for _, item := range value.Content {
+				merged = append(merged, enc.getMappingPairs(item, depth+1)...)
+			}
+			continue
+		}
+		merged = append(merged, enc.getMappingPairs(value, depth+1)...)
+	}
+	return append(merged, pairs...)
+}
+
+// encodeScalar writes a YAML scalar as JSON value
+func (enc *yamlEncoder) encodeScalar(node *yaml.Node) error {
+	var value interface{}
+	switch node.ShortTag() {
+	case "!!str", "!!timestamp", "!!binary":
+		value = node.Value
+	default:
+		if err := node.Decode(&value); err != nil {
+			return &positionError{Line: node.Line, Column: node.Column, Err: err}
+		}
+	}
+	if f, ok := value.(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+		return &positionError{Line: node.Line, Column: node.Column, Err: fmt.Errorf("invalid number: %s", node.Value)}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return &positionError{Line: node.Line, Column: node.Column, Err: err}
+	}
+	enc.buf.Write(data)
+	return nil
+}
+
+// getPositionError adds the line and column of the source YAML node to a JSON decoding error
+func (enc *yamlEncoder) getPositionError(err error) error {
+	var offset int
+	switch jerr := err.(type) {
+	case *json.SyntaxError:
+		offset = int(jerr.Offset) - 1
+	case *json.UnmarshalTypeError:
+		offset = int(jerr.Offset) - 1
+	default:
+		return err
+	}
+	// the spans are stored in post-order, so the first one containing the offset is the innermost value
+	for _, span := range enc.spans {
+		if offset >= span.start && offset < span.end {
+			return &positionError{Line: span.node.Line, Column: span.node.Column, Err: err}
+		}
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected string
+	}{
+		{"a: 1\nb: [true, null, 1.5]\nc: text", `{"a":1,"b":[true,null,1.5],"c":"text"}`},
+		{"- x: &v {k: 1}\n  y: *v", `[{"x":{"k":1},"y":{"k":1}}]`},
+		{"base: &b {k: 1, j: 2}\nitem:\n  <<: *b\n  j: 3", `{"base":{"k":1,"j":2},"item":{"k":1,"j":2,"j":3}}`},
+		{"s: |\n  line1\n  line2\n", `{"s":"line1\nline2\n"}`},
+		{"d: 2024-01-02T03:04:05Z\nn: '123'", `{"d":"2024-01-02T03:04:05Z","n":"123"}`},
+		{`{"a": "~re:[0-9]+"}`, `{"a":"~re:[0-9]+"}`},
+	}
+	for _, tt := range tests {
+		data, _, err := yamlToJSON([]byte(tt.raw))
+		if err != nil || string(data) != tt.expected {
+			t.Error(fmt.Errorf("found different value than expected: %s %v", data, err))
+		}
+	}
+
+	errors := []struct {
+		raw      string
+		expected string
+	}{
+		{"", "empty"},
+		{"a: [1, 2", "line 1"},
+		{"a: .inf", "line 1, column 4:"},
+		{"? [a, b]\n: c", "line 1, column 3:"},
+		{"a: &a [*a]", "too deeply nested"},
+	}
+	for _, tt := range errors {
+		_, _, err := yamlToJSON([]byte(tt.raw))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Error(fmt.Errorf("the error should contain %q, found: %v", tt.expected, err))
+		}
+	}
+}
+
+func TestLoadRawYAMLTest(t *testing.T) {
+	oldTestMap, oldNames, oldDefs := testMap, testNames, testDefs
+	testMap = make(map[string]TestEntries)
+	testNames = make([]string, 0)
+	testDefs = make(map[string]TestFile)
+	defer func() {
+		testMap, testNames, testDefs = oldTestMap, oldNames, oldDefs
+	}()
+
+	err := loadRawYAMLTest([]byte(`
+params:
+  userId: {required: true}
+steps:
+  # first step
+  - Name: create
+    Topic: "@.yaml.test"
+    Request: {user: "~pm:userId"}
+    Response: {user: "~re:[0-9]+"}
+    Capture:
+      user: Response.user
+`), "yaml")
+	if err != nil {
+		t.Error(fmt.Errorf("an error was not expected: %v", err))
+		return
+	}
+	expected := TestEntries{{
+		Name:     "create",
+		Topic:    "@.yaml.test",
+		Request:  map[string]interface{}{"user": "~pm:userId"},
+		Response: map[string]interface{}{"user": "~re:[0-9]+"},
+		Capture:  map[string]string{"user": "Response.user"},
+		Source:   "test_yaml.yaml:steps[0]",
+	}}
+	if !reflect.DeepEqual(testMap["yaml"], expected) || !testDefs["yaml"].Params["userId"].Required {
+		t.Error(fmt.Errorf("found different value than expected: %#v", testMap["yaml"]))
+	}
+
+	err = loadRawYAMLTest([]byte("- Topic: a\n- Topic:\n    nested: map\n"), "yaml")
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3, column 5:") {
+		t.Error(fmt.Errorf("a position error was expected, found: %v", err))
+	}
+}
+
+func TestIsYAMLContent(t *testing.T) {
+	tests := []struct {
+		contentType string
+		raw         string
+		expected    bool
+	}{
+		{"application/yaml", `{"a": 1}`, true},
+		{"application/x-yaml; charset=utf-8", "", true},
+		{"application/json", `[{"Topic": "a"}]`, false},
+		{"application/json", ` {"steps": []}`, false},
+		{"application/json", "- Topic: a", true},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if isYAMLContent(tt.contentType, []byte(tt.raw)) != tt.expected {
+			t.Error(fmt.Errorf("%q %q: expected %v", tt.contentType, tt.raw, tt.expected))
+		}
+	}
+}